@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	principalFlag = "principal"
+	actionFlag    = "action"
+	infoHashFlag  = "infohash"
+	sinceFlag     = "since"
+)
+
+var (
+	errMissingAuditLog = errors.New("missing audit log")
+)
+
+var auditCmd = &cobra.Command{
+	Use:     "audit",
+	Aliases: []string{"a"},
+	Short:   "Query the gateway's audit log",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(auditLogFlag)) == "" {
+			return errMissingAuditLog
+		}
+
+		since := int64(0)
+		if d := viper.GetDuration(sinceFlag); d > 0 {
+			since = time.Now().Add(-d).Unix()
+		}
+
+		events := []v1.AuditEvent{}
+		if err := server.ReadAuditLog(
+			viper.GetString(auditLogFlag),
+			viper.GetInt(auditLogMaxBackupsFlag),
+			func(event v1.AuditEvent) error {
+				if event.Time < since {
+					return nil
+				}
+
+				if principal := viper.GetString(principalFlag); principal != "" && event.Principal != principal {
+					return nil
+				}
+
+				if action := viper.GetString(actionFlag); action != "" && event.Action != action {
+					return nil
+				}
+
+				if infoHash := viper.GetString(infoHashFlag); infoHash != "" && !strings.EqualFold(event.InfoHash, infoHash) {
+					return nil
+				}
+
+				events = append(events, event)
+
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+
+		y, err := yaml.Marshal(events)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", y)
+
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.PersistentFlags().String(auditLogFlag, "", "Path to the gateway's audit log")
+	auditCmd.PersistentFlags().Int(auditLogMaxBackupsFlag, 10, "Maximum amount of rotated audit logs to read")
+	auditCmd.PersistentFlags().StringP(principalFlag, "u", "", "Only show events for this principal")
+	auditCmd.PersistentFlags().StringP(actionFlag, "a", "", "Only show events with this action (add, create, upload, stream, remove, reject or cancel)")
+	auditCmd.PersistentFlags().StringP(infoHashFlag, "i", "", "Only show events for this infohash")
+	auditCmd.PersistentFlags().DurationP(sinceFlag, "s", 0, "Only show events which are newer than this duration (i.e. 24h; 0 to show all events)")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	tokenFlag           = "token"
+	oidcRedirectURLFlag = "oidc-redirect-url"
+)
+
+func getToken(ctx context.Context) (string, error) {
+	if token := strings.TrimSpace(viper.GetString(tokenFlag)); token != "" {
+		return token, nil
+	}
+
+	if strings.TrimSpace(viper.GetString(oidcIssuerFlag)) != "" && strings.TrimSpace(viper.GetString(oidcClientIDFlag)) != "" {
+		if strings.TrimSpace(viper.GetString(oidcRedirectURLFlag)) != "" {
+			return client.GetOIDCTokenWithAuthorizationCodeFlow(
+				ctx,
+				viper.GetString(oidcIssuerFlag),
+				viper.GetString(oidcClientIDFlag),
+				viper.GetString(oidcRedirectURLFlag),
+				func(authCodeURL string) {
+					fmt.Fprintf(os.Stderr, "Open the following URL in your browser to authenticate: %v\n", authCodeURL)
+				},
+			)
+		}
+
+		return client.GetOIDCTokenWithDeviceFlow(
+			ctx,
+			viper.GetString(oidcIssuerFlag),
+			viper.GetString(oidcClientIDFlag),
+			func(verificationURI, userCode string) {
+				fmt.Fprintf(os.Stderr, "Open the following URL in your browser and enter the code %v to authenticate: %v\n", userCode, verificationURI)
+			},
+		)
+	}
+
+	if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+		return "", errMissingAPIPassword
+	}
+
+	if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+		return "", errMissingAPIUsername
+	}
+
+	return "", nil
+}
+
+func addAuthFlags(flags *pflag.FlagSet) {
+	flags.StringP(apiUsernameFlag, "u", "admin", "Username for the gateway")
+	flags.StringP(apiPasswordFlag, "p", "", "Password for the gateway")
+	flags.StringP(tokenFlag, "t", "", "OIDC ID token for the gateway (can also be set using the TOKEN env variable); takes precedence over the username and password")
+	flags.String(oidcIssuerFlag, "", "OIDC Issuer to interactively get a token from if no token is set (i.e. https://pojntfx.eu.auth0.com/) (can also be set using the OIDC_ISSUER env variable)")
+	flags.String(oidcClientIDFlag, "", "OIDC Client ID to interactively get a token with if no token is set (i.e. myoidcclientid) (can also be set using the OIDC_CLIENT_ID env variable)")
+	flags.String(oidcRedirectURLFlag, "", "OIDC redirect URL to use the authorization code flow with instead of the device flow (i.e. http://localhost:11337) (can also be set using the OIDC_REDIRECT_URL env variable)")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var bandwidthCmd = &cobra.Command{
+	Use:     "bandwidth",
+	Aliases: []string{"b"},
+	Short:   "Get or set the maximum download and upload rates of the gateway",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		var downloadRate, uploadRate *int
+		if cmd.PersistentFlags().Changed(downloadRateFlag) {
+			d := viper.GetInt(downloadRateFlag)
+			downloadRate = &d
+		}
+
+		if cmd.PersistentFlags().Changed(uploadRateFlag) {
+			u := viper.GetInt(uploadRateFlag)
+			uploadRate = &u
+		}
+
+		var bandwidth v1.Bandwidth
+		if downloadRate == nil && uploadRate == nil {
+			bandwidth, err = manager.GetBandwidth()
+		} else {
+			bandwidth, err = manager.SetBandwidth(downloadRate, uploadRate)
+		}
+		if err != nil {
+			return err
+		}
+
+		y, err := yaml.Marshal(bandwidth)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", y)
+
+		return nil
+	},
+}
+
+func init() {
+	addAuthFlags(bandwidthCmd.PersistentFlags())
+	bandwidthCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	bandwidthCmd.PersistentFlags().Int(downloadRateFlag, 0, "Maximum download rate in bytes per second to set (0 for unlimited); left unchanged if not set")
+	bandwidthCmd.PersistentFlags().Int(uploadRateFlag, 0, "Maximum upload rate in bytes per second to set (0 for unlimited); left unchanged if not set")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(bandwidthCmd)
+}
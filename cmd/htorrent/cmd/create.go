@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	torrentVersionFlag = "torrent-version"
+	pieceLengthFlag    = "piece-length"
+	commentFlag        = "comment"
+	privateFlag        = "private"
+)
+
+type createdTorrentWithStreamURL struct {
+	Magnet     string              `yaml:"magnet"`
+	Name       string              `yaml:"name"`
+	InfoHash   string              `yaml:"infohash"`
+	InfoHashV2 string              `yaml:"infohashV2,omitempty"`
+	Files      []fileWithStreamURL `yaml:"files"`
+}
+
+var createCmd = &cobra.Command{
+	Use:     "create",
+	Aliases: []string{"c"},
+	Short:   "Create a torrent from a file or directory in the gateway's seed directory and seed it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(fileFlag)) == "" {
+			return server.ErrEmptyPath
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		created, err := manager.CreateTorrent(viper.GetString(fileFlag), client.TorrentCreation{
+			Version:     viper.GetString(torrentVersionFlag),
+			PieceLength: viper.GetInt64(pieceLengthFlag),
+			Trackers:    viper.GetStringSlice(trackersFlag),
+			WebSeeds:    viper.GetStringSlice(webSeedsFlag),
+			Comment:     viper.GetString(commentFlag),
+			Private:     viper.GetBool(privateFlag),
+		})
+		if err != nil {
+			return err
+		}
+
+		return printCreatedTorrent(viper.GetString(raddrFlag), created)
+	},
+}
+
+func printCreatedTorrent(raddr string, created v1.CreatedTorrent) error {
+	c := createdTorrentWithStreamURL{
+		Magnet:     created.Magnet,
+		Name:       created.Info.Name,
+		InfoHash:   created.Info.InfoHash,
+		InfoHashV2: created.Info.InfoHashV2,
+		Files:      []fileWithStreamURL{},
+	}
+
+	for _, f := range created.Info.Files {
+		streamURL, err := getStreamURL(raddr, created.Magnet, f.Path)
+		if err != nil {
+			return err
+		}
+
+		c.Files = append(c.Files, fileWithStreamURL{
+			Index:      f.Index,
+			Path:       f.Path,
+			Length:     f.Length,
+			PiecesRoot: f.PiecesRoot,
+			StreamURL:  streamURL,
+		})
+	}
+
+	y, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s", y)
+
+	return nil
+}
+
+func init() {
+	addAuthFlags(createCmd.PersistentFlags())
+	createCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	createCmd.PersistentFlags().StringP(fileFlag, "f", "", "Path of the file or directory to create the torrent from, relative to the gateway's seed directory")
+	createCmd.PersistentFlags().String(torrentVersionFlag, server.TorrentVersionV1, "Version of the torrent to create (v1, v2 or hybrid for a torrent that is compatible with both v1 and v2 clients)")
+	createCmd.PersistentFlags().Int64(pieceLengthFlag, 0, "Piece length of the torrent in bytes, must be a power of two and at least 16384 (0 to choose based on the size of the content)")
+	createCmd.PersistentFlags().StringSlice(trackersFlag, []string{}, "Comma-separated list of trackers to add to the torrent (i.e. udp://tracker.opentrackr.org:1337/announce)")
+	createCmd.PersistentFlags().StringSlice(webSeedsFlag, []string{}, "Comma-separated list of HTTP mirrors (BEP 19 web seeds) to add to the torrent (i.e. https://example.com/mirror/)")
+	createCmd.PersistentFlags().String(commentFlag, "", "Comment to add to the torrent")
+	createCmd.PersistentFlags().Bool(privateFlag, false, "Whether to mark the torrent as private, which disables DHT and PEX for it")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(createCmd)
+}
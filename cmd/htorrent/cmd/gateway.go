@@ -7,7 +7,9 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
 	"github.com/pojntfx/htorrent/pkg/server"
@@ -17,12 +19,65 @@ import (
 )
 
 const (
-	storageFlag      = "storage"
-	laddrFlag        = "laddr"
-	apiUsernameFlag  = "api-username"
-	apiPasswordFlag  = "api-password"
-	oidcIssuerFlag   = "oidc-issuer"
-	oidcClientIDFlag = "oidc-client-id"
+	storageFlag            = "storage"
+	storageBackendFlag     = "storage-backend"
+	storageCapacityFlag    = "storage-capacity"
+	seedDirFlag            = "seed-dir"
+	s3EndpointFlag         = "s3-endpoint"
+	s3BucketFlag           = "s3-bucket"
+	s3PrefixFlag           = "s3-prefix"
+	s3AccessKeyFlag        = "s3-access-key"
+	s3SecretKeyFlag        = "s3-secret-key"
+	s3RegionFlag           = "s3-region"
+	s3InsecureFlag         = "s3-insecure"
+	sessionFlag            = "session"
+	laddrFlag              = "laddr"
+	basePathFlag           = "base-path"
+	apiUsernameFlag        = "api-username"
+	apiPasswordFlag        = "api-password"
+	usersFileFlag          = "users-file"
+	oidcIssuerFlag         = "oidc-issuer"
+	oidcClientIDFlag       = "oidc-client-id"
+	rolesFileFlag          = "roles-file"
+	policyFileFlag         = "policy-file"
+	oidcRolesClaimFlag     = "oidc-roles-claim"
+	defaultRoleFlag        = "default-role"
+	limitByFlag            = "limit-by"
+	maxStreamsFlag         = "max-streams"
+	requestRateFlag        = "request-rate"
+	requestBurstFlag       = "request-burst"
+	egressRateFlag         = "egress-rate"
+	seedFlag               = "seed"
+	seedRatioFlag          = "seed-ratio"
+	seedTimeFlag           = "seed-time"
+	downloadRateFlag       = "download-rate"
+	uploadRateFlag         = "upload-rate"
+	bandwidthScheduleFlag  = "bandwidth-schedule"
+	torrentPortFlag        = "torrent-port"
+	torrentInterfaceFlag   = "torrent-interface"
+	disableDHTFlag         = "disable-dht"
+	disablePEXFlag         = "disable-pex"
+	disableUTPFlag         = "disable-utp"
+	disableTCPFlag         = "disable-tcp"
+	disableIPv6Flag        = "disable-ipv6"
+	trackersFlag           = "trackers"
+	encryptionFlag         = "encryption"
+	peerIDPrefixFlag       = "peer-id-prefix"
+	tlsCertFlag            = "tls-cert"
+	tlsKeyFlag             = "tls-key"
+	tlsClientCAFlag        = "tls-client-ca"
+	tlsClientAuthFlag      = "tls-client-auth"
+	tlsACMEDomainsFlag     = "tls-acme-domains"
+	tlsACMEEmailFlag       = "tls-acme-email"
+	tlsACMECacheFlag       = "tls-acme-cache"
+	registryFlag           = "registry"
+	advertiseURLFlag       = "advertise-url"
+	clusterModeFlag        = "cluster-mode"
+	clusterSecretFlag      = "cluster-secret"
+	auditLogFlag           = "audit-log"
+	auditLogMaxSizeFlag    = "audit-log-max-size"
+	auditLogMaxBackupsFlag = "audit-log-max-backups"
+	progressIntervalFlag   = "progress-interval"
 )
 
 var gatewayCmd = &cobra.Command{
@@ -53,22 +108,118 @@ var gatewayCmd = &cobra.Command{
 			addr.Port = p
 		}
 
+		var defaultRole server.Role
+		if strings.TrimSpace(viper.GetString(defaultRoleFlag)) != "" {
+			defaultRole, err = server.ParseRole(viper.GetString(defaultRoleFlag))
+			if err != nil {
+				return err
+			}
+		}
+
+		bandwidthSchedule := []server.BandwidthSchedule{}
+		for _, rawSchedule := range viper.GetStringSlice(bandwidthScheduleFlag) {
+			schedule, err := server.ParseBandwidthSchedule(rawSchedule)
+			if err != nil {
+				return err
+			}
+
+			bandwidthSchedule = append(bandwidthSchedule, schedule)
+		}
+
+		var auditLog *server.AuditLog
+		if strings.TrimSpace(viper.GetString(auditLogFlag)) != "" {
+			auditLog = server.NewAuditLog(
+				viper.GetString(auditLogFlag),
+				viper.GetInt64(auditLogMaxSizeFlag),
+				viper.GetInt(auditLogMaxBackupsFlag),
+			)
+		}
+
 		gateway := server.NewGateway(
-			addr.String(),
-			viper.GetString(storageFlag),
-			viper.GetString(apiUsernameFlag),
-			viper.GetString(apiPasswordFlag),
-			viper.GetString(oidcIssuerFlag),
-			viper.GetString(oidcClientIDFlag),
-			viper.GetInt(verboseFlag) > 5,
-			func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics) {
-				log.Debug().
-					Str("magnet", torrentMetrics.Magnet).
-					Int("peers", torrentMetrics.Peers).
-					Str("path", fileMetrics.Path).
-					Int64("length", fileMetrics.Length).
-					Int64("completed", fileMetrics.Completed).
-					Msg("Streaming")
+			server.GatewayConfig{
+				LAddr:           addr.String(),
+				BasePath:        viper.GetString(basePathFlag),
+				Storage:         viper.GetString(storageFlag),
+				StorageType:     viper.GetString(storageBackendFlag),
+				StorageCapacity: viper.GetInt64(storageCapacityFlag),
+				SeedDir:         viper.GetString(seedDirFlag),
+				S3: server.S3{
+					Endpoint:  viper.GetString(s3EndpointFlag),
+					Bucket:    viper.GetString(s3BucketFlag),
+					Prefix:    viper.GetString(s3PrefixFlag),
+					AccessKey: viper.GetString(s3AccessKeyFlag),
+					SecretKey: viper.GetString(s3SecretKeyFlag),
+					Region:    viper.GetString(s3RegionFlag),
+					Insecure:  viper.GetBool(s3InsecureFlag),
+				},
+				SessionPath:  viper.GetString(sessionFlag),
+				APIUsername:  viper.GetString(apiUsernameFlag),
+				APIPassword:  viper.GetString(apiPasswordFlag),
+				UsersFile:    viper.GetString(usersFileFlag),
+				OIDCIssuer:   viper.GetString(oidcIssuerFlag),
+				OIDCClientID: viper.GetString(oidcClientIDFlag),
+				RolesFile:    viper.GetString(rolesFileFlag),
+				PolicyFile:   viper.GetString(policyFileFlag),
+				RolesClaim:   viper.GetString(oidcRolesClaimFlag),
+				DefaultRole:  defaultRole,
+				Limits: server.Limits{
+					LimitBy:      viper.GetString(limitByFlag),
+					MaxStreams:   viper.GetInt(maxStreamsFlag),
+					RequestRate:  viper.GetFloat64(requestRateFlag),
+					RequestBurst: viper.GetInt(requestBurstFlag),
+					EgressRate:   viper.GetInt(egressRateFlag),
+				},
+				Seeding: server.Seeding{
+					Disabled: !viper.GetBool(seedFlag),
+					Ratio:    viper.GetFloat64(seedRatioFlag),
+					Duration: viper.GetDuration(seedTimeFlag),
+				},
+				Bandwidth: server.Bandwidth{
+					DownloadRate: viper.GetInt(downloadRateFlag),
+					UploadRate:   viper.GetInt(uploadRateFlag),
+					Schedule:     bandwidthSchedule,
+				},
+				Network: server.Network{
+					ListenPort:   viper.GetInt(torrentPortFlag),
+					Interface:    viper.GetString(torrentInterfaceFlag),
+					DisableDHT:   viper.GetBool(disableDHTFlag),
+					DisablePEX:   viper.GetBool(disablePEXFlag),
+					DisableUTP:   viper.GetBool(disableUTPFlag),
+					DisableTCP:   viper.GetBool(disableTCPFlag),
+					DisableIPv6:  viper.GetBool(disableIPv6Flag),
+					Trackers:     viper.GetStringSlice(trackersFlag),
+					Encryption:   viper.GetString(encryptionFlag),
+					PeerIDPrefix: viper.GetString(peerIDPrefixFlag),
+				},
+				TLS: server.TLS{
+					CertFile:     viper.GetString(tlsCertFlag),
+					KeyFile:      viper.GetString(tlsKeyFlag),
+					ClientCAFile: viper.GetString(tlsClientCAFlag),
+					ClientAuth:   viper.GetString(tlsClientAuthFlag),
+					ACMEDomains:  viper.GetStringSlice(tlsACMEDomainsFlag),
+					ACMEEmail:    viper.GetString(tlsACMEEmailFlag),
+					ACMECacheDir: viper.GetString(tlsACMECacheFlag),
+				},
+				Cluster: server.Cluster{
+					Registry:     viper.GetString(registryFlag),
+					AdvertiseURL: viper.GetString(advertiseURLFlag),
+					Mode:         viper.GetString(clusterModeFlag),
+					Secret:       viper.GetString(clusterSecretFlag),
+				},
+				AuditLog: auditLog,
+				Debug:    viper.GetInt(verboseFlag) > 5,
+
+				ProgressInterval: viper.GetDuration(progressIntervalFlag),
+
+				OnDownloadProgress: func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics) {
+					log.Debug().
+						Str("magnet", torrentMetrics.Magnet).
+						Int("peers", torrentMetrics.Peers).
+						Str("path", fileMetrics.Path).
+						Int64("length", fileMetrics.Length).
+						Int64("completed", fileMetrics.Completed).
+						Msg("Streaming")
+				},
 			},
 			ctx,
 		)
@@ -77,7 +228,21 @@ var gatewayCmd = &cobra.Command{
 			return err
 		}
 
-		s := make(chan os.Signal)
+		h := make(chan os.Signal, 1)
+		signal.Notify(h, syscall.SIGHUP)
+		go func() {
+			for range h {
+				log.Info().Msg("Reloading users, roles and policy")
+
+				if err := gateway.Reload(); err != nil {
+					log.Error().
+						Err(err).
+						Msg("Could not reload users, roles and policy, continuing with previous ones")
+				}
+			}
+		}()
+
+		s := make(chan os.Signal, 1)
 		signal.Notify(s, os.Interrupt, syscall.SIGTERM)
 		go func() {
 			<-s
@@ -116,11 +281,64 @@ func init() {
 	}
 
 	gatewayCmd.PersistentFlags().StringP(storageFlag, "s", filepath.Join(home, ".local", "share", "htorrent", "var", "lib", "htorrent", "data"), "Path to store downloaded torrents in")
+	gatewayCmd.PersistentFlags().String(storageBackendFlag, server.StorageFile, "Storage backend for downloaded torrents (file, mmap, sqlite, bolt, memory or s3); sqlite and bolt store all pieces in a single database in the storage path, memory doesn't persist anything, s3 stores pieces in a bucket and uses the storage path as a local cache")
+	gatewayCmd.PersistentFlags().Int64(storageCapacityFlag, 0, "Maximum size of the sqlite and memory storage backends or the local cache of the s3 storage backend in bytes, after which the least recently used pieces are evicted (0 for unlimited; required for memory; not supported by the file, mmap and bolt backends)")
+	gatewayCmd.PersistentFlags().String(seedDirFlag, "", "Directory with local files and directories that torrents can be created from and seeded (i.e. /srv/media); disables torrent creation if empty")
+	gatewayCmd.PersistentFlags().String(s3EndpointFlag, "", "Endpoint of the S3-compatible object storage for the s3 storage backend (i.e. s3.amazonaws.com or localhost:9000)")
+	gatewayCmd.PersistentFlags().String(s3BucketFlag, "htorrent", "Bucket to store pieces in for the s3 storage backend; created if it doesn't exist")
+	gatewayCmd.PersistentFlags().String(s3PrefixFlag, "", "Prefix for the object names of pieces in the bucket (i.e. pieces/)")
+	gatewayCmd.PersistentFlags().String(s3AccessKeyFlag, "", "Access key for the S3-compatible object storage (can also be set using the S3_ACCESS_KEY env variable)")
+	gatewayCmd.PersistentFlags().String(s3SecretKeyFlag, "", "Secret key for the S3-compatible object storage (can also be set using the S3_SECRET_KEY env variable)")
+	gatewayCmd.PersistentFlags().String(s3RegionFlag, "", "Region of the bucket (i.e. us-east-1)")
+	gatewayCmd.PersistentFlags().Bool(s3InsecureFlag, false, "Whether to connect to the S3-compatible object storage without TLS")
+	gatewayCmd.PersistentFlags().String(sessionFlag, filepath.Join(home, ".local", "share", "htorrent", "var", "lib", "htorrent", "session.db"), "Path to the database to persist the added torrents, their pause state and file priorities in across restarts (disabled if empty)")
 	gatewayCmd.PersistentFlags().StringP(laddrFlag, "l", ":1337", "Listening address")
+	gatewayCmd.PersistentFlags().String(basePathFlag, "", "Path prefix to serve the API under, i.e. if the gateway is behind a reverse proxy (i.e. /htorrent); the remote address of clients must include it with a trailing slash (i.e. https://example.com/htorrent/)")
 	gatewayCmd.PersistentFlags().String(apiUsernameFlag, "admin", "Username for the management API (can also be set using the API_USERNAME env variable). Ignored if any of the OIDC parameters are set.")
 	gatewayCmd.PersistentFlags().String(apiPasswordFlag, "", "Password for the management API (can also be set using the API_PASSWORD env variable). Ignored if any of the OIDC parameters are set.")
+	gatewayCmd.PersistentFlags().String(usersFileFlag, "", "Path to a htpasswd-style file with one username:hash pair per line (bcrypt or argon2id hashes, see htorrent passwd); reloaded on SIGHUP. Replaces the API username and password if set. Ignored if any of the OIDC parameters are set.")
 	gatewayCmd.PersistentFlags().String(oidcIssuerFlag, "", "OIDC Issuer (i.e. https://pojntfx.eu.auth0.com/) (can also be set using the OIDC_ISSUER env variable)")
 	gatewayCmd.PersistentFlags().String(oidcClientIDFlag, "", "OIDC Client ID (i.e. myoidcclientid) (can also be set using the OIDC_CLIENT_ID env variable)")
+	gatewayCmd.PersistentFlags().String(rolesFileFlag, "", "Path to a file which maps users to roles, with one username:role pair (i.e. jane:viewer) per line; valid roles are admin and viewer; reloaded on SIGHUP")
+	gatewayCmd.PersistentFlags().String(policyFileFlag, "", "Path to a YAML file with a policy for which torrents may be added (allowInfoHashes, denyInfoHashes, allowTrackerDomains, denyTrackerDomains, maxSize in bytes, allowExtensions and denyExtensions); reloaded on SIGHUP")
+	gatewayCmd.PersistentFlags().String(oidcRolesClaimFlag, "roles", "OIDC claim to get the roles of a user from (i.e. realm_access.roles); ignored for users in the roles file")
+	gatewayCmd.PersistentFlags().String(defaultRoleFlag, "", "Role for users which are neither in the roles file nor have a role claim (admin or viewer); required if OIDC or TLS client certificates are enabled (admin for local users if empty)")
+	gatewayCmd.PersistentFlags().String(limitByFlag, server.LimitByUser, "Whether to apply the stream, request and egress limits per user or per IP address (user or ip)")
+	gatewayCmd.PersistentFlags().Int(maxStreamsFlag, 0, "Maximum amount of concurrent streams per user or IP address (0 for unlimited)")
+	gatewayCmd.PersistentFlags().Float64(requestRateFlag, 0, "Maximum amount of requests per second per user or IP address (0 for unlimited)")
+	gatewayCmd.PersistentFlags().Int(requestBurstFlag, 0, "Amount of requests per user or IP address which may exceed the request rate in a burst (0 to round up the request rate)")
+	gatewayCmd.PersistentFlags().Int(egressRateFlag, 0, "Maximum egress bandwidth for streams in bytes per second per user or IP address (0 for unlimited)")
+	gatewayCmd.PersistentFlags().Bool(seedFlag, true, "Whether to seed torrents after they have been downloaded; can be overwritten per torrent with htorrent update")
+	gatewayCmd.PersistentFlags().Float64(seedRatioFlag, 0, "Ratio of uploaded bytes to the size of a torrent after which to stop seeding it (0 for unlimited)")
+	gatewayCmd.PersistentFlags().Duration(seedTimeFlag, 0, "Duration after which to stop seeding a torrent once it has been downloaded (i.e. 48h) (0 for unlimited)")
+	gatewayCmd.PersistentFlags().Int(downloadRateFlag, 0, "Maximum BitTorrent download rate in bytes per second (0 for unlimited); can be changed at runtime with htorrent bandwidth")
+	gatewayCmd.PersistentFlags().Int(uploadRateFlag, 0, "Maximum BitTorrent upload rate in bytes per second (0 for unlimited); can be changed at runtime with htorrent bandwidth")
+	gatewayCmd.PersistentFlags().StringSlice(bandwidthScheduleFlag, []string{}, "Download and upload rates in bytes per second to use instead of the maximum rates during a time of day, in the format start-end=download/upload (i.e. 01:00-07:00=0/0 for full speed overnight)")
+	gatewayCmd.PersistentFlags().Int(torrentPortFlag, 0, "Port to listen for BitTorrent peers on, i.e. to forward it (0 for a random port)")
+	gatewayCmd.PersistentFlags().String(torrentInterfaceFlag, "", "Network interface or IP address to listen for BitTorrent peers on (i.e. eth0 or 192.168.1.2) (all interfaces if empty)")
+	gatewayCmd.PersistentFlags().Bool(disableDHTFlag, false, "Whether to disable finding peers using the DHT")
+	gatewayCmd.PersistentFlags().Bool(disablePEXFlag, false, "Whether to disable finding peers using peer exchange")
+	gatewayCmd.PersistentFlags().Bool(disableUTPFlag, false, "Whether to disable connecting to peers using uTP")
+	gatewayCmd.PersistentFlags().Bool(disableTCPFlag, false, "Whether to disable connecting to peers using TCP")
+	gatewayCmd.PersistentFlags().Bool(disableIPv6Flag, false, "Whether to disable connecting to peers using IPv6")
+	gatewayCmd.PersistentFlags().StringSlice(trackersFlag, []string{}, "Additional trackers to announce all torrents to (i.e. udp://tracker.opentrackr.org:1337/announce)")
+	gatewayCmd.PersistentFlags().String(encryptionFlag, server.EncryptionPrefer, "Whether to encrypt connections to peers (none, allow, prefer or require)")
+	gatewayCmd.PersistentFlags().String(peerIDPrefixFlag, "", "Prefix of the peer ID to identify the client with to other peers (i.e. -HT0001-) (the default prefix of the BitTorrent library if empty)")
+	gatewayCmd.PersistentFlags().String(tlsCertFlag, "", "Path to a TLS certificate to serve HTTPS and HTTP/2 with; reloaded when it changes")
+	gatewayCmd.PersistentFlags().String(tlsKeyFlag, "", "Path to the TLS key for the TLS certificate; reloaded when it changes")
+	gatewayCmd.PersistentFlags().String(tlsClientCAFlag, "", "Path to a CA to verify TLS client certificates with; the common name of a client certificate is used as the username")
+	gatewayCmd.PersistentFlags().String(tlsClientAuthFlag, server.ClientAuthNone, "Whether TLS client certificates are required to connect (none, optional or required)")
+	gatewayCmd.PersistentFlags().StringSlice(tlsACMEDomainsFlag, []string{}, "Domains to automatically get TLS certificates for using ACME (i.e. Let's Encrypt); can't be used together with a TLS certificate")
+	gatewayCmd.PersistentFlags().String(tlsACMEEmailFlag, "", "Contact email to use for ACME")
+	gatewayCmd.PersistentFlags().String(tlsACMECacheFlag, filepath.Join(home, ".local", "share", "htorrent", "var", "lib", "htorrent", "acme"), "Path to cache the certificates from ACME in")
+	gatewayCmd.PersistentFlags().String(registryFlag, "", "URL of a Redis-compatible registry to share torrents between multiple gateways with (i.e. redis://localhost:6379/0) (can also be set using the REGISTRY env variable) (disabled if empty)")
+	gatewayCmd.PersistentFlags().String(advertiseURLFlag, "", "URL under which the other gateways in the cluster can reach this gateway, including the base path (i.e. http://10.0.0.2:1337/); required if a registry is set")
+	gatewayCmd.PersistentFlags().String(clusterModeFlag, server.ClusterModeProxy, "How to forward requests for torrents which another gateway in the cluster already has (proxy or redirect)")
+	gatewayCmd.PersistentFlags().String(clusterSecretFlag, "", "Secret shared by all gateways in the cluster to authenticate proxied requests with (can also be set using the CLUSTER_SECRET env variable); required if a registry is set")
+	gatewayCmd.PersistentFlags().String(auditLogFlag, "", "Path to write an append-only audit log of added, created, uploaded, removed, rejected and streamed torrents and canceled streams to as JSON lines (disabled if empty)")
+	gatewayCmd.PersistentFlags().Int64(auditLogMaxSizeFlag, 100*1024*1024, "Size in bytes after which to rotate the audit log (0 to never rotate)")
+	gatewayCmd.PersistentFlags().Int(auditLogMaxBackupsFlag, 10, "Maximum amount of rotated audit logs to keep")
+	gatewayCmd.PersistentFlags().Duration(progressIntervalFlag, time.Millisecond*100, "Interval in which to report the download progress of streamed files")
 
 	viper.AutomaticEnv()
 
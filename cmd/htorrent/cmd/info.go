@@ -30,15 +30,18 @@ var (
 type infoWithStreamURL struct {
 	Name         string              `yaml:"name"`
 	InfoHash     string              `json:"infohash"`
+	InfoHashV2   string              `yaml:"infohashV2,omitempty"`
 	Description  string              `yaml:"description"`
 	CreationDate int64               `yaml:"creationDate"`
 	Files        []fileWithStreamURL `yaml:"files"`
 }
 
 type fileWithStreamURL struct {
-	Path      string `yaml:"path"`
-	Length    int64  `yaml:"length"`
-	StreamURL string `yaml:"streamURL"`
+	Index      int    `yaml:"index"`
+	Path       string `yaml:"path"`
+	Length     int64  `yaml:"length"`
+	PiecesRoot string `yaml:"piecesRoot,omitempty"`
+	StreamURL  string `yaml:"streamURL"`
 }
 
 var infoCmd = &cobra.Command{
@@ -50,14 +53,6 @@ var infoCmd = &cobra.Command{
 			return err
 		}
 
-		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
-			return errMissingAPIPassword
-		}
-
-		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
-			return errMissingAPIUsername
-		}
-
 		if strings.TrimSpace(viper.GetString(magnetFlag)) == "" {
 			return server.ErrEmptyMagnetLink
 		}
@@ -65,10 +60,16 @@ var infoCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
 		manager := client.NewManager(
 			viper.GetString(raddrFlag),
 			viper.GetString(apiUsernameFlag),
 			viper.GetString(apiPasswordFlag),
+			token,
 			ctx,
 		)
 
@@ -81,6 +82,7 @@ var infoCmd = &cobra.Command{
 			i := infoWithStreamURL{
 				Name:         info.Name,
 				InfoHash:     info.InfoHash,
+				InfoHashV2:   info.InfoHashV2,
 				Description:  info.Description,
 				CreationDate: info.CreationDate,
 				Files:        []fileWithStreamURL{},
@@ -93,9 +95,11 @@ var infoCmd = &cobra.Command{
 				}
 
 				i.Files = append(i.Files, fileWithStreamURL{
-					Path:      f.Path,
-					Length:    f.Length,
-					StreamURL: streamURL,
+					Index:      f.Index,
+					Path:       f.Path,
+					Length:     f.Length,
+					PiecesRoot: f.PiecesRoot,
+					StreamURL:  streamURL,
 				})
 			}
 
@@ -134,7 +138,7 @@ func getStreamURL(base string, magnet, path string) (string, error) {
 		return "", err
 	}
 
-	streamSuffix, err := url.Parse("/stream")
+	streamSuffix, err := url.Parse("stream")
 	if err != nil {
 		return "", err
 	}
@@ -150,8 +154,7 @@ func getStreamURL(base string, magnet, path string) (string, error) {
 }
 
 func init() {
-	infoCmd.PersistentFlags().StringP(apiUsernameFlag, "u", "admin", "Username for the gateway")
-	infoCmd.PersistentFlags().StringP(apiPasswordFlag, "p", "", "Username or OIDC access token for the gateway")
+	addAuthFlags(infoCmd.PersistentFlags())
 	infoCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
 	infoCmd.PersistentFlags().StringP(magnetFlag, "m", "", "Magnet link to get info for")
 	infoCmd.PersistentFlags().StringP(expressionFlag, "x", "", "Regex to select the link to output by, i.e. (.*).mkv$ to only return the first .mkv file; disables all other info")
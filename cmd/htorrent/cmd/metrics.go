@@ -3,14 +3,19 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"strings"
 
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
 	"github.com/pojntfx/htorrent/pkg/client"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	limitsFlag = "limits"
+	followFlag = "follow"
+)
+
 var metricsCmd = &cobra.Command{
 	Use:     "metrics",
 	Aliases: []string{"m"},
@@ -20,25 +25,50 @@ var metricsCmd = &cobra.Command{
 			return err
 		}
 
-		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
-			return errMissingAPIPassword
-		}
-
-		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
-			return errMissingAPIUsername
-		}
-
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
 		manager := client.NewManager(
 			viper.GetString(raddrFlag),
 			viper.GetString(apiUsernameFlag),
 			viper.GetString(apiPasswordFlag),
+			token,
 			ctx,
 		)
 
-		metrics, err := manager.GetMetrics()
+		if viper.GetBool(followFlag) {
+			var encodeErr error
+			if err := manager.FollowProgress(func(event v1.ProgressEvent) {
+				if encodeErr != nil {
+					return
+				}
+
+				y, err := yaml.Marshal(event)
+				if err != nil {
+					encodeErr = err
+
+					return
+				}
+
+				fmt.Printf("---\n%s", y)
+			}); err != nil {
+				return err
+			}
+
+			return encodeErr
+		}
+
+		var metrics any
+		if viper.GetBool(limitsFlag) {
+			metrics, err = manager.GetLimitMetrics()
+		} else {
+			metrics, err = manager.GetMetrics()
+		}
 		if err != nil {
 			return err
 		}
@@ -55,9 +85,10 @@ var metricsCmd = &cobra.Command{
 }
 
 func init() {
-	metricsCmd.PersistentFlags().StringP(apiUsernameFlag, "u", "admin", "Username for the gateway")
-	metricsCmd.PersistentFlags().StringP(apiPasswordFlag, "p", "", "Username or OIDC access token for the gateway")
+	addAuthFlags(metricsCmd.PersistentFlags())
 	metricsCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	metricsCmd.PersistentFlags().BoolP(limitsFlag, "l", false, "Get the current rate and stream limit counts instead of the torrent metrics")
+	metricsCmd.PersistentFlags().BoolP(followFlag, "f", false, "Follow the download progress of the streamed files instead of getting the metrics once")
 
 	viper.AutomaticEnv()
 
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	algorithmFlag = "algorithm"
+)
+
+var passwdCmd = &cobra.Command{
+	Use:     "passwd",
+	Aliases: []string{"p"},
+	Short:   "Hash a password for the gateway's users file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		hash, err := server.HashPassword(viper.GetString(apiPasswordFlag), viper.GetString(algorithmFlag))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%v:%v\n", viper.GetString(apiUsernameFlag), hash)
+
+		return nil
+	},
+}
+
+func init() {
+	passwdCmd.PersistentFlags().StringP(apiUsernameFlag, "u", "admin", "Username to hash the password for")
+	passwdCmd.PersistentFlags().StringP(apiPasswordFlag, "p", "", "Password to hash (can also be set using the API_PASSWORD env variable)")
+	passwdCmd.PersistentFlags().StringP(algorithmFlag, "a", "bcrypt", "Hash algorithm to use (bcrypt or argon2id)")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(passwdCmd)
+}
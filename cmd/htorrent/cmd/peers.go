@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var peersCmd = &cobra.Command{
+	Use:     "peers",
+	Aliases: []string{"pe"},
+	Short:   "Get the connected and known peers and the tracker status of a torrent from the gateway",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(magnetFlag)) == "" {
+			return server.ErrEmptyMagnetLink
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		swarm, err := manager.GetSwarm(viper.GetString(magnetFlag))
+		if err != nil {
+			return err
+		}
+
+		y, err := yaml.Marshal(swarm)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", y)
+
+		return nil
+	},
+}
+
+func init() {
+	addAuthFlags(peersCmd.PersistentFlags())
+	peersCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	peersCmd.PersistentFlags().StringP(magnetFlag, "m", "", "Magnet link of the torrent to get the peers for")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(peersCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var removeCmd = &cobra.Command{
+	Use:     "remove",
+	Aliases: []string{"r"},
+	Short:   "Remove a torrent from the gateway",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(magnetFlag)) == "" {
+			return server.ErrEmptyMagnetLink
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		return manager.RemoveTorrent(viper.GetString(magnetFlag))
+	},
+}
+
+func init() {
+	addAuthFlags(removeCmd.PersistentFlags())
+	removeCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	removeCmd.PersistentFlags().StringP(magnetFlag, "m", "", "Magnet link of the torrent to remove")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(removeCmd)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	cancelFlag = "cancel"
+)
+
+var streamsCmd = &cobra.Command{
+	Use:     "streams",
+	Aliases: []string{"s"},
+	Short:   "List or cancel the active streams of the gateway",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		if id := strings.TrimSpace(viper.GetString(cancelFlag)); id != "" {
+			return manager.CancelStream(id)
+		}
+
+		streams, err := manager.GetStreams()
+		if err != nil {
+			return err
+		}
+
+		y, err := yaml.Marshal(streams)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", y)
+
+		return nil
+	},
+}
+
+func init() {
+	addAuthFlags(streamsCmd.PersistentFlags())
+	streamsCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	streamsCmd.PersistentFlags().StringP(cancelFlag, "c", "", "ID of a stream to cancel instead of listing the active streams")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(streamsCmd)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	pausedFlag   = "paused"
+	fileFlag     = "file"
+	indexFlag    = "index"
+	priorityFlag = "priority"
+	webSeedsFlag = "web-seeds"
+)
+
+var updateCmd = &cobra.Command{
+	Use:     "update",
+	Aliases: []string{"u"},
+	Short:   "Pause or resume a torrent, set the priority of a file in it, change its seeding policy or bandwidth limits or add web seeds to it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(magnetFlag)) == "" {
+			return server.ErrEmptyMagnetLink
+		}
+
+		update := client.TorrentUpdate{
+			Path:     viper.GetString(fileFlag),
+			Priority: viper.GetString(priorityFlag),
+			WebSeeds: viper.GetStringSlice(webSeedsFlag),
+		}
+
+		if cmd.PersistentFlags().Changed(pausedFlag) {
+			p := viper.GetBool(pausedFlag)
+			update.Paused = &p
+		}
+
+		if cmd.PersistentFlags().Changed(indexFlag) {
+			i := viper.GetInt(indexFlag)
+			update.Index = &i
+		}
+
+		if cmd.PersistentFlags().Changed(seedFlag) {
+			s := viper.GetBool(seedFlag)
+			update.Seed = &s
+		}
+
+		if cmd.PersistentFlags().Changed(seedRatioFlag) {
+			r := viper.GetFloat64(seedRatioFlag)
+			update.SeedRatio = &r
+		}
+
+		if cmd.PersistentFlags().Changed(seedTimeFlag) {
+			d := viper.GetDuration(seedTimeFlag)
+			update.SeedTime = &d
+		}
+
+		if cmd.PersistentFlags().Changed(downloadRateFlag) {
+			d := viper.GetInt(downloadRateFlag)
+			update.DownloadRate = &d
+		}
+
+		if cmd.PersistentFlags().Changed(uploadRateFlag) {
+			u := viper.GetInt(uploadRateFlag)
+			update.UploadRate = &u
+		}
+
+		if strings.TrimSpace(update.Priority) != "" && strings.TrimSpace(update.Path) == "" && update.Index == nil {
+			return server.ErrEmptyPath
+		}
+
+		if update.Paused == nil && strings.TrimSpace(update.Priority) == "" && update.Seed == nil && update.SeedRatio == nil && update.SeedTime == nil && update.DownloadRate == nil && update.UploadRate == nil && len(update.WebSeeds) == 0 {
+			return server.ErrEmptyUpdate
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		return manager.UpdateTorrent(viper.GetString(magnetFlag), update)
+	},
+}
+
+func init() {
+	addAuthFlags(updateCmd.PersistentFlags())
+	updateCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	updateCmd.PersistentFlags().StringP(magnetFlag, "m", "", "Magnet link of the torrent to update")
+	updateCmd.PersistentFlags().Bool(pausedFlag, false, "Whether to pause (--paused) or resume (--paused=false) the torrent; left unchanged if not set")
+	updateCmd.PersistentFlags().StringP(fileFlag, "f", "", "Path of the file in the torrent to set the priority for")
+	updateCmd.PersistentFlags().IntP(indexFlag, "i", 0, "Index of the file in the torrent to set the priority for (as shown by htorrent info); takes precedence over --file")
+	updateCmd.PersistentFlags().StringP(priorityFlag, "P", "", "Priority to set for the file (none, normal or high)")
+	updateCmd.PersistentFlags().Bool(seedFlag, true, "Whether to seed the torrent after it has been downloaded; left unchanged if not set")
+	updateCmd.PersistentFlags().Float64(seedRatioFlag, 0, "Ratio of uploaded bytes to the size of the torrent after which to stop seeding it (0 for unlimited); left unchanged if not set")
+	updateCmd.PersistentFlags().Duration(seedTimeFlag, 0, "Duration after which to stop seeding the torrent once it has been downloaded (i.e. 48h) (0 for unlimited); left unchanged if not set")
+
+	updateCmd.PersistentFlags().Int(downloadRateFlag, 0, "Maximum download rate for the torrent in bytes per second (0 for unlimited); left unchanged if not set")
+	updateCmd.PersistentFlags().Int(uploadRateFlag, 0, "Maximum upload rate for the torrent in bytes per second (0 for unlimited); left unchanged if not set")
+
+	updateCmd.PersistentFlags().StringSlice(webSeedsFlag, []string{}, "Comma-separated list of HTTP mirrors (BEP 19 web seeds) to additionally download the torrent from (i.e. https://example.com/mirror/)")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(updateCmd)
+}
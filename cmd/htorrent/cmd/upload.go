@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pojntfx/htorrent/pkg/client"
+	"github.com/pojntfx/htorrent/pkg/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	nameFlag = "name"
+)
+
+var uploadCmd = &cobra.Command{
+	Use:     "upload",
+	Aliases: []string{"up"},
+	Short:   "Upload a local file to the gateway, create a torrent from it and seed it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(fileFlag)) == "" {
+			return server.ErrEmptyPath
+		}
+
+		name := viper.GetString(nameFlag)
+		if strings.TrimSpace(name) == "" {
+			name = filepath.Base(viper.GetString(fileFlag))
+		}
+
+		f, err := os.Open(viper.GetString(fileFlag))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := getToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		manager := client.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			token,
+			ctx,
+		)
+
+		created, err := manager.UploadTorrent(name, f, stat.Size(), client.TorrentCreation{
+			Version:     viper.GetString(torrentVersionFlag),
+			PieceLength: viper.GetInt64(pieceLengthFlag),
+			Trackers:    viper.GetStringSlice(trackersFlag),
+			WebSeeds:    viper.GetStringSlice(webSeedsFlag),
+			Comment:     viper.GetString(commentFlag),
+			Private:     viper.GetBool(privateFlag),
+		})
+		if err != nil {
+			return err
+		}
+
+		return printCreatedTorrent(viper.GetString(raddrFlag), created)
+	},
+}
+
+func init() {
+	addAuthFlags(uploadCmd.PersistentFlags())
+	uploadCmd.PersistentFlags().StringP(raddrFlag, "r", "http://localhost:1337/", "Remote address")
+	uploadCmd.PersistentFlags().StringP(fileFlag, "f", "", "Path of the local file to upload")
+	uploadCmd.PersistentFlags().StringP(nameFlag, "n", "", "Name of the file in the torrent (defaults to the name of the local file)")
+	uploadCmd.PersistentFlags().String(torrentVersionFlag, server.TorrentVersionV1, "Version of the torrent to create (v1, v2 or hybrid for a torrent that is compatible with both v1 and v2 clients)")
+	uploadCmd.PersistentFlags().Int64(pieceLengthFlag, 0, "Piece length of the torrent in bytes, must be a power of two and at least 16384 (0 to choose based on the size of the file)")
+	uploadCmd.PersistentFlags().StringSlice(trackersFlag, []string{}, "Comma-separated list of trackers to add to the torrent (i.e. udp://tracker.opentrackr.org:1337/announce)")
+	uploadCmd.PersistentFlags().StringSlice(webSeedsFlag, []string{}, "Comma-separated list of HTTP mirrors (BEP 19 web seeds) to add to the torrent (i.e. https://example.com/mirror/)")
+	uploadCmd.PersistentFlags().String(commentFlag, "", "Comment to add to the torrent")
+	uploadCmd.PersistentFlags().Bool(privateFlag, false, "Whether to mark the torrent as private, which disables DHT and PEX for it")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(uploadCmd)
+}
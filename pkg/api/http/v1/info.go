@@ -3,25 +3,154 @@ package v1
 type Info struct {
 	Name         string `json:"name"`
 	InfoHash     string `json:"infohash"`
+	InfoHashV2   string `json:"infohashV2,omitempty"`
 	Description  string `json:"description"`
 	CreationDate int64  `json:"creationDate"`
 	Files        []File `json:"files"`
 }
 
 type File struct {
-	Path   string `json:"path"`
-	Length int64  `json:"length"`
+	Index      int    `json:"index"`
+	Path       string `json:"path"`
+	Length     int64  `json:"length"`
+	PiecesRoot string `json:"piecesRoot,omitempty"`
+}
+
+type CreatedTorrent struct {
+	Magnet  string   `json:"magnet"`
+	Info    Info     `json:"info"`
+	Streams []Stream `json:"streams"`
+}
+
+type Stream struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
 }
 
 type TorrentMetrics struct {
-	Magnet   string        `json:"magnet"`
-	InfoHash string        `json:"infohash"`
-	Peers    int           `json:"peers"`
-	Files    []FileMetrics `json:"files"`
+	Magnet                 string           `json:"magnet"`
+	InfoHash               string           `json:"infohash"`
+	InfoHashV2             string           `json:"infohashV2,omitempty"`
+	Peers                  int              `json:"peers"`
+	Paused                 bool             `json:"paused"`
+	Uploaded               int64            `json:"uploaded"`
+	Ratio                  float64          `json:"ratio"`
+	Seeding                bool             `json:"seeding"`
+	DownloadLimit          int              `json:"downloadLimit"`
+	UploadLimit            int              `json:"uploadLimit"`
+	DownloadedFromPeers    int64            `json:"downloadedFromPeers"`
+	DownloadedFromWebSeeds int64            `json:"downloadedFromWebSeeds"`
+	WebSeeds               []WebSeedMetrics `json:"webSeeds"`
+	DownloadRate           int64            `json:"downloadRate"`
+	UploadRate             int64            `json:"uploadRate"`
+	ETA                    int64            `json:"eta"`
+	Streams                []StreamMetrics  `json:"streams"`
+	Files                  []FileMetrics    `json:"files"`
+}
+
+type WebSeedMetrics struct {
+	Host       string `json:"host"`
+	Downloaded int64  `json:"downloaded"`
 }
 
 type FileMetrics struct {
-	Path      string `json:"path"`
-	Length    int64  `json:"length"`
-	Completed int64  `json:"completed"`
+	Index        int    `json:"index"`
+	Path         string `json:"path"`
+	Length       int64  `json:"length"`
+	Completed    int64  `json:"completed"`
+	Priority     string `json:"priority"`
+	PiecesRoot   string `json:"piecesRoot,omitempty"`
+	DownloadRate int64  `json:"downloadRate"`
+	UploadRate   int64  `json:"uploadRate"`
+	ETA          int64  `json:"eta"`
+}
+
+type ProgressEvent struct {
+	Torrent TorrentMetrics `json:"torrent"`
+	File    FileMetrics    `json:"file"`
+}
+
+type StreamMetrics struct {
+	ID         string `json:"id"`
+	Principal  string `json:"principal"`
+	RemoteAddr string `json:"remoteAddr"`
+	InfoHash   string `json:"infohash"`
+	Index      int    `json:"index"`
+	Path       string `json:"path"`
+	Length     int64  `json:"length"`
+	Offset     int64  `json:"offset"`
+	Sent       int64  `json:"sent"`
+	EgressRate int64  `json:"egressRate"`
+	Started    int64  `json:"started"`
+}
+
+type Swarm struct {
+	InfoHash         string           `json:"infohash"`
+	InfoHashV2       string           `json:"infohashV2,omitempty"`
+	ConnectedSeeders int              `json:"connectedSeeders"`
+	HalfOpenPeers    int              `json:"halfOpenPeers"`
+	PendingPeers     int              `json:"pendingPeers"`
+	Peers            []PeerMetrics    `json:"peers"`
+	KnownPeers       []KnownPeer      `json:"knownPeers"`
+	Trackers         []TrackerMetrics `json:"trackers"`
+}
+
+type PeerMetrics struct {
+	Address             string   `json:"address"`
+	Network             string   `json:"network"`
+	Source              string   `json:"source"`
+	Client              string   `json:"client"`
+	DownloadRate        int64    `json:"downloadRate"`
+	EstimatedUploadRate int64    `json:"estimatedUploadRate"`
+	Pieces              int      `json:"pieces"`
+	Choked              bool     `json:"choked"`
+	Interested          bool     `json:"interested"`
+	Flags               []string `json:"flags"`
+}
+
+type KnownPeer struct {
+	Address string `json:"address"`
+	Source  string `json:"source"`
+}
+
+type TrackerMetrics struct {
+	URL           string `json:"url"`
+	Announced     int64  `json:"announced"`
+	NextAnnounce  int64  `json:"nextAnnounce"`
+	Interval      int64  `json:"interval"`
+	Peers         int    `json:"peers"`
+	AnnounceError string `json:"announceError,omitempty"`
+	Seeders       int    `json:"seeders"`
+	Leechers      int    `json:"leechers"`
+	Downloaded    int    `json:"downloaded"`
+	Scraped       int64  `json:"scraped"`
+	ScrapeError   string `json:"scrapeError,omitempty"`
+}
+
+type LimitMetrics struct {
+	Key        string `json:"key"`
+	Streams    int    `json:"streams"`
+	MaxStreams int    `json:"maxStreams"`
+	Requests   int64  `json:"requests"`
+	Rejected   int64  `json:"rejected"`
+	Egressed   int64  `json:"egressed"`
+}
+
+type AuditEvent struct {
+	Time       int64  `json:"time"`
+	Action     string `json:"action"`
+	Principal  string `json:"principal"`
+	RemoteAddr string `json:"remoteAddr"`
+	Magnet     string `json:"magnet,omitempty"`
+	InfoHash   string `json:"infohash,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	Duration   int64  `json:"duration,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Bandwidth struct {
+	DownloadRate int  `json:"downloadRate"`
+	UploadRate   int  `json:"uploadRate"`
+	Scheduled    bool `json:"scheduled"`
 }
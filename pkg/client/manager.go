@@ -1,10 +1,15 @@
 package client
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
@@ -18,6 +23,7 @@ type Manager struct {
 	url      string
 	username string
 	password string
+	token    string
 	ctx      context.Context
 }
 
@@ -25,12 +31,14 @@ func NewManager(
 	url string,
 	username string,
 	password string,
+	token string,
 	ctx context.Context,
 ) *Manager {
 	return &Manager{
 		url:      url,
 		username: username,
 		password: password,
+		token:    token,
 		ctx:      ctx,
 	}
 }
@@ -43,7 +51,7 @@ func (m *Manager) GetInfo(magnetLink string) (v1.Info, error) {
 		return v1.Info{}, err
 	}
 
-	infoSuffix, err := url.Parse("/info")
+	infoSuffix, err := url.Parse("info")
 	if err != nil {
 		return v1.Info{}, err
 	}
@@ -58,7 +66,7 @@ func (m *Manager) GetInfo(magnetLink string) (v1.Info, error) {
 	if err != nil {
 		return v1.Info{}, err
 	}
-	req.SetBasicAuth(m.username, m.password)
+	m.setAuthorization(req)
 
 	res, err := hc.Do(req)
 	if err != nil {
@@ -88,7 +96,7 @@ func (m *Manager) GetMetrics() ([]v1.TorrentMetrics, error) {
 		return []v1.TorrentMetrics{}, err
 	}
 
-	infoSuffix, err := url.Parse("/metrics")
+	infoSuffix, err := url.Parse("metrics")
 	if err != nil {
 		return []v1.TorrentMetrics{}, err
 	}
@@ -99,7 +107,7 @@ func (m *Manager) GetMetrics() ([]v1.TorrentMetrics, error) {
 	if err != nil {
 		return []v1.TorrentMetrics{}, err
 	}
-	req.SetBasicAuth(m.username, m.password)
+	m.setAuthorization(req)
 
 	res, err := hc.Do(req)
 	if err != nil {
@@ -120,3 +128,517 @@ func (m *Manager) GetMetrics() ([]v1.TorrentMetrics, error) {
 
 	return metrics, nil
 }
+
+func (m *Manager) FollowProgress(onEvent func(event v1.ProgressEvent)) error {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return err
+	}
+
+	eventsSuffix, err := url.Parse("events")
+	if err != nil {
+		return err
+	}
+
+	eventsURL := baseURL.ResolveReference(eventsSuffix)
+
+	req, err := http.NewRequestWithContext(m.ctx, http.MethodGet, eventsURL.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		event := v1.ProgressEvent{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+
+		onEvent(event)
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Manager) GetSwarm(magnetLink string) (v1.Swarm, error) {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return v1.Swarm{}, err
+	}
+
+	peersSuffix, err := url.Parse("peers")
+	if err != nil {
+		return v1.Swarm{}, err
+	}
+
+	peersURL := baseURL.ResolveReference(peersSuffix)
+
+	q := peersURL.Query()
+	q.Set("magnet", magnetLink)
+	peersURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, peersURL.String(), http.NoBody)
+	if err != nil {
+		return v1.Swarm{}, err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return v1.Swarm{}, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return v1.Swarm{}, errors.New(res.Status)
+	}
+
+	swarm := v1.Swarm{}
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(&swarm); err != nil {
+		return v1.Swarm{}, err
+	}
+
+	return swarm, nil
+}
+
+func (m *Manager) GetLimitMetrics() ([]v1.LimitMetrics, error) {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return []v1.LimitMetrics{}, err
+	}
+
+	infoSuffix, err := url.Parse("metrics/limits")
+	if err != nil {
+		return []v1.LimitMetrics{}, err
+	}
+
+	infoURL := baseURL.ResolveReference(infoSuffix)
+
+	req, err := http.NewRequest(http.MethodGet, infoURL.String(), http.NoBody)
+	if err != nil {
+		return []v1.LimitMetrics{}, err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return []v1.LimitMetrics{}, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return []v1.LimitMetrics{}, errors.New(res.Status)
+	}
+
+	metrics := []v1.LimitMetrics{}
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(&metrics); err != nil {
+		return []v1.LimitMetrics{}, err
+	}
+
+	return metrics, nil
+}
+
+func (m *Manager) GetStreams() ([]v1.StreamMetrics, error) {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return []v1.StreamMetrics{}, err
+	}
+
+	streamsSuffix, err := url.Parse("streams")
+	if err != nil {
+		return []v1.StreamMetrics{}, err
+	}
+
+	streamsURL := baseURL.ResolveReference(streamsSuffix)
+
+	req, err := http.NewRequest(http.MethodGet, streamsURL.String(), http.NoBody)
+	if err != nil {
+		return []v1.StreamMetrics{}, err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return []v1.StreamMetrics{}, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return []v1.StreamMetrics{}, errors.New(res.Status)
+	}
+
+	streams := []v1.StreamMetrics{}
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(&streams); err != nil {
+		return []v1.StreamMetrics{}, err
+	}
+
+	return streams, nil
+}
+
+func (m *Manager) CancelStream(id string) error {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return err
+	}
+
+	streamSuffix, err := url.Parse("streams/" + url.PathEscape(id))
+	if err != nil {
+		return err
+	}
+
+	streamURL := baseURL.ResolveReference(streamSuffix)
+
+	req, err := http.NewRequest(http.MethodDelete, streamURL.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+func (m *Manager) RemoveTorrent(magnetLink string) error {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return err
+	}
+
+	torrentsSuffix, err := url.Parse("torrents")
+	if err != nil {
+		return err
+	}
+
+	torrentsURL := baseURL.ResolveReference(torrentsSuffix)
+
+	q := torrentsURL.Query()
+	q.Set("magnet", magnetLink)
+	torrentsURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodDelete, torrentsURL.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+type TorrentUpdate struct {
+	Paused    *bool
+	Path      string
+	Index     *int
+	Priority  string
+	Seed      *bool
+	SeedRatio *float64
+	SeedTime  *time.Duration
+
+	DownloadRate *int
+	UploadRate   *int
+
+	WebSeeds []string
+}
+
+func (m *Manager) UpdateTorrent(magnetLink string, update TorrentUpdate) error {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return err
+	}
+
+	torrentsSuffix, err := url.Parse("torrents")
+	if err != nil {
+		return err
+	}
+
+	torrentsURL := baseURL.ResolveReference(torrentsSuffix)
+
+	q := torrentsURL.Query()
+	q.Set("magnet", magnetLink)
+	if update.Paused != nil {
+		q.Set("paused", strconv.FormatBool(*update.Paused))
+	}
+	if update.Priority != "" {
+		if update.Index != nil {
+			q.Set("index", strconv.Itoa(*update.Index))
+		} else {
+			q.Set("path", update.Path)
+		}
+		q.Set("priority", update.Priority)
+	}
+	if update.Seed != nil {
+		q.Set("seed", strconv.FormatBool(*update.Seed))
+	}
+	if update.SeedRatio != nil {
+		q.Set("seedRatio", strconv.FormatFloat(*update.SeedRatio, 'f', -1, 64))
+	}
+	if update.SeedTime != nil {
+		q.Set("seedTime", update.SeedTime.String())
+	}
+	if update.DownloadRate != nil {
+		q.Set("downloadRate", strconv.Itoa(*update.DownloadRate))
+	}
+	if update.UploadRate != nil {
+		q.Set("uploadRate", strconv.Itoa(*update.UploadRate))
+	}
+	for _, webSeed := range update.WebSeeds {
+		q.Add("webSeed", webSeed)
+	}
+	torrentsURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, torrentsURL.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+type TorrentCreation struct {
+	Version     string
+	PieceLength int64
+	Trackers    []string
+	WebSeeds    []string
+	Comment     string
+	Private     bool
+}
+
+func (m *Manager) CreateTorrent(path string, creation TorrentCreation) (v1.CreatedTorrent, error) {
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+
+	createSuffix, err := url.Parse("create")
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+
+	createURL := baseURL.ResolveReference(createSuffix)
+
+	q := createURL.Query()
+	q.Set("path", path)
+	setCreationQuery(q, creation)
+	createURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, createURL.String(), http.NoBody)
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+	m.setAuthorization(req)
+
+	return m.doCreate(req)
+}
+
+func (m *Manager) UploadTorrent(name string, body io.Reader, length int64, creation TorrentCreation) (v1.CreatedTorrent, error) {
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+
+	uploadSuffix, err := url.Parse("upload")
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+
+	uploadURL := baseURL.ResolveReference(uploadSuffix)
+
+	q := uploadURL.Query()
+	q.Set("name", name)
+	setCreationQuery(q, creation)
+	uploadURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPut, uploadURL.String(), body)
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+	req.ContentLength = length
+	m.setAuthorization(req)
+
+	return m.doCreate(req)
+}
+
+func setCreationQuery(q url.Values, creation TorrentCreation) {
+	if creation.Version != "" {
+		q.Set("version", creation.Version)
+	}
+	if creation.PieceLength > 0 {
+		q.Set("pieceLength", strconv.FormatInt(creation.PieceLength, 10))
+	}
+	for _, tracker := range creation.Trackers {
+		q.Add("tracker", tracker)
+	}
+	for _, webSeed := range creation.WebSeeds {
+		q.Add("webSeed", webSeed)
+	}
+	if creation.Comment != "" {
+		q.Set("comment", creation.Comment)
+	}
+	if creation.Private {
+		q.Set("private", strconv.FormatBool(creation.Private))
+	}
+}
+
+func (m *Manager) doCreate(req *http.Request) (v1.CreatedTorrent, error) {
+	hc := &http.Client{}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return v1.CreatedTorrent{}, errors.New(res.Status)
+	}
+
+	created := v1.CreatedTorrent{}
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(&created); err != nil {
+		return v1.CreatedTorrent{}, err
+	}
+
+	return created, nil
+}
+
+func (m *Manager) GetBandwidth() (v1.Bandwidth, error) {
+	return m.requestBandwidth(http.MethodGet, nil, nil)
+}
+
+func (m *Manager) SetBandwidth(downloadRate, uploadRate *int) (v1.Bandwidth, error) {
+	return m.requestBandwidth(http.MethodPost, downloadRate, uploadRate)
+}
+
+func (m *Manager) requestBandwidth(method string, downloadRate, uploadRate *int) (v1.Bandwidth, error) {
+	hc := &http.Client{}
+
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return v1.Bandwidth{}, err
+	}
+
+	bandwidthSuffix, err := url.Parse("bandwidth")
+	if err != nil {
+		return v1.Bandwidth{}, err
+	}
+
+	bandwidthURL := baseURL.ResolveReference(bandwidthSuffix)
+
+	q := bandwidthURL.Query()
+	if downloadRate != nil {
+		q.Set("downloadRate", strconv.Itoa(*downloadRate))
+	}
+	if uploadRate != nil {
+		q.Set("uploadRate", strconv.Itoa(*uploadRate))
+	}
+	bandwidthURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(method, bandwidthURL.String(), http.NoBody)
+	if err != nil {
+		return v1.Bandwidth{}, err
+	}
+	m.setAuthorization(req)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return v1.Bandwidth{}, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return v1.Bandwidth{}, errors.New(res.Status)
+	}
+
+	bandwidth := v1.Bandwidth{}
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(&bandwidth); err != nil {
+		return v1.Bandwidth{}, err
+	}
+
+	return bandwidth, nil
+}
+
+func (m *Manager) setAuthorization(req *http.Request) {
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+
+		return
+	}
+
+	req.SetBasicAuth(m.username, m.password)
+}
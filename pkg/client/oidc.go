@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrMissingIDToken           = errors.New("could not find ID token in OIDC token response")
+	ErrDeviceFlowNotSupported   = errors.New("OIDC issuer does not support the device authorization flow")
+	ErrMissingAuthorizationCode = errors.New("could not find authorization code in OIDC redirect")
+	ErrInvalidState             = errors.New("OIDC redirect has invalid state")
+)
+
+func getOIDCConfig(ctx context.Context, issuer, clientID, redirectURL string) (*oauth2.Config, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:    clientID,
+		Endpoint:    provider.Endpoint(),
+		RedirectURL: redirectURL,
+		Scopes:      []string{oidc.ScopeOpenID, "profile", "email"},
+	}, nil
+}
+
+func getIDToken(token *oauth2.Token) (string, error) {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return "", ErrMissingIDToken
+	}
+
+	return idToken, nil
+}
+
+func GetOIDCTokenWithDeviceFlow(
+	ctx context.Context,
+	issuer string,
+	clientID string,
+	onDeviceCode func(verificationURI, userCode string),
+) (string, error) {
+	config, err := getOIDCConfig(ctx, issuer, clientID, "")
+	if err != nil {
+		return "", err
+	}
+
+	if config.Endpoint.DeviceAuthURL == "" {
+		return "", ErrDeviceFlowNotSupported
+	}
+
+	res, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	verificationURI := res.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = res.VerificationURI
+	}
+
+	onDeviceCode(verificationURI, res.UserCode)
+
+	token, err := config.DeviceAccessToken(ctx, res)
+	if err != nil {
+		return "", err
+	}
+
+	return getIDToken(token)
+}
+
+func GetOIDCTokenWithAuthorizationCodeFlow(
+	ctx context.Context,
+	issuer string,
+	clientID string,
+	redirectURL string,
+	onAuthCodeURL func(authCodeURL string),
+) (string, error) {
+	config, err := getOIDCConfig(ctx, issuer, clientID, redirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	lis, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return "", err
+	}
+	defer lis.Close()
+
+	state := oauth2.GenerateVerifier()
+	verifier := oauth2.GenerateVerifier()
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := u.Path; r.URL.Path != p && !(p == "" && r.URL.Path == "/") {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			if r.URL.Query().Get("state") != state {
+				http.Error(w, ErrInvalidState.Error(), http.StatusBadRequest)
+
+				fail(ErrInvalidState)
+
+				return
+			}
+
+			code := r.URL.Query().Get("code")
+			if code == "" {
+				http.Error(w, ErrMissingAuthorizationCode.Error(), http.StatusBadRequest)
+
+				fail(ErrMissingAuthorizationCode)
+
+				return
+			}
+
+			if _, err := w.Write([]byte("Authentication successful, you may now close this window.")); err != nil {
+				fail(err)
+
+				return
+			}
+
+			select {
+			case codes <- code:
+			default:
+			}
+		}),
+	}
+	defer srv.Shutdown(ctx)
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			fail(err)
+		}
+	}()
+
+	onAuthCodeURL(config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)))
+
+	var code string
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case err := <-errs:
+		return "", err
+	case code = <-codes:
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return "", err
+	}
+
+	return getIDToken(token)
+}
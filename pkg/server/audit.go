@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	AuditActionAdd    = "add"
+	AuditActionCreate = "create"
+	AuditActionUpload = "upload"
+	AuditActionStream = "stream"
+	AuditActionRemove = "remove"
+	AuditActionReject = "reject"
+	AuditActionCancel = "cancel"
+)
+
+type AuditLog struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewAuditLog(path string, maxSize int64, maxBackups int) *AuditLog {
+	return &AuditLog{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+}
+
+func (a *AuditLog) Open() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.open()
+}
+
+func (a *AuditLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	a.file = file
+	a.size = stat.Size()
+
+	return nil
+}
+
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+
+	if a.maxBackups > 0 {
+		for i := a.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(getAuditLogBackupPath(a.path, i), getAuditLogBackupPath(a.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		if err := os.Rename(a.path, getAuditLogBackupPath(a.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(a.path); err != nil {
+		return err
+	}
+
+	return a.open()
+}
+
+func (a *AuditLog) Write(event v1.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+
+	return err
+}
+
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	return a.file.Close()
+}
+
+func getAuditLogBackupPath(path string, i int) string {
+	return fmt.Sprintf("%v.%v", path, i)
+}
+
+func ReadAuditLog(path string, maxBackups int, onEvent func(event v1.AuditEvent) error) error {
+	paths := []string{}
+	for i := maxBackups; i > 0; i-- {
+		paths = append(paths, getAuditLogBackupPath(path, i))
+	}
+	paths = append(paths, path)
+
+	for _, p := range paths {
+		if err := readAuditLogFile(p, onEvent); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readAuditLogFile(path string, onEvent func(event v1.AuditEvent) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var event v1.AuditEvent
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := onEvent(event); err != nil {
+			return err
+		}
+	}
+}
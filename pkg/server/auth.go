@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/pojntfx/go-auth-utils/pkg/authn"
+)
+
+const (
+	bearerPrefix = "Bearer "
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleViewer Role = "viewer"
+)
+
+var (
+	ErrUnknownRole         = errors.New("unknown role")
+	ErrInvalidRolesLine    = errors.New("invalid line in roles file")
+	ErrForbidden           = errors.New("principal is not allowed to do this")
+	ErrCouldNotFindSubject = errors.New("could not find subject in OIDC token")
+	ErrMissingDefaultRole  = errors.New("default role must be set explicitly if OIDC or TLS client certificates are enabled")
+)
+
+func ParseRole(role string) (Role, error) {
+	switch r := Role(strings.TrimSpace(role)); r {
+	case RoleAdmin, RoleViewer:
+		return r, nil
+	default:
+		return "", fmt.Errorf("%w: %v", ErrUnknownRole, role)
+	}
+}
+
+func (r Role) CanAddTorrents() bool {
+	return r == RoleAdmin
+}
+
+func (r Role) CanRemoveTorrents() bool {
+	return r == RoleAdmin
+}
+
+func (r Role) CanManageTorrents() bool {
+	return r == RoleAdmin
+}
+
+func (r Role) CanGetMetrics() bool {
+	return r == RoleAdmin
+}
+
+type Principal struct {
+	Name string
+	Role Role
+}
+
+type Authenticator interface {
+	Open(ctx context.Context) error
+	Authenticate(username, token string) (Principal, error)
+	Challenge() string
+}
+
+func LoadRoles(rolesFile string) (map[string]Role, error) {
+	roles := map[string]Role{}
+	if strings.TrimSpace(rolesFile) == "" {
+		return roles, nil
+	}
+
+	f, err := os.Open(rolesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, rawRole, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%w: %v:%v", ErrInvalidRolesLine, rolesFile, i)
+		}
+
+		role, err := ParseRole(rawRole)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v:%v", err, rolesFile, i)
+		}
+
+		roles[strings.TrimSpace(name)] = role
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+type basicAuthenticator struct {
+	auth        authn.Authn
+	roles       map[string]Role
+	defaultRole Role
+}
+
+func NewBasicAuthenticator(auth authn.Authn, roles map[string]Role, defaultRole Role) Authenticator {
+	return &basicAuthenticator{
+		auth:        auth,
+		roles:       roles,
+		defaultRole: defaultRole,
+	}
+}
+
+func (a *basicAuthenticator) Open(ctx context.Context) error {
+	return a.auth.Open(ctx)
+}
+
+func (a *basicAuthenticator) Authenticate(username, token string) (Principal, error) {
+	if err := a.auth.Validate(username, token); err != nil {
+		return Principal{}, err
+	}
+
+	role, ok := a.roles[username]
+	if !ok {
+		role = a.defaultRole
+	}
+
+	return Principal{
+		Name: username,
+		Role: role,
+	}, nil
+}
+
+type oidcAuthenticator struct {
+	issuer      string
+	clientID    string
+	rolesClaim  string
+	roles       map[string]Role
+	defaultRole Role
+
+	ctx context.Context
+
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCAuthenticator(
+	issuer string,
+	clientID string,
+	rolesClaim string,
+	roles map[string]Role,
+	defaultRole Role,
+) Authenticator {
+	return &oidcAuthenticator{
+		issuer:      issuer,
+		clientID:    clientID,
+		rolesClaim:  rolesClaim,
+		roles:       roles,
+		defaultRole: defaultRole,
+	}
+}
+
+func (a *basicAuthenticator) Challenge() string {
+	return `Basic realm="hTorrent"`
+}
+
+func (a *oidcAuthenticator) Open(ctx context.Context) error {
+	provider, err := oidc.NewProvider(ctx, a.issuer)
+	if err != nil {
+		return err
+	}
+
+	a.ctx = ctx
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: a.clientID})
+
+	return nil
+}
+
+func (a *oidcAuthenticator) Authenticate(_, token string) (Principal, error) {
+	idToken, err := a.verifier.Verify(a.ctx, token)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Principal{}, err
+	}
+
+	name := ""
+	for _, key := range []string{"preferred_username", "email", "sub"} {
+		if value, ok := claims[key].(string); ok && strings.TrimSpace(value) != "" {
+			name = value
+
+			break
+		}
+	}
+
+	if name == "" {
+		return Principal{}, ErrCouldNotFindSubject
+	}
+
+	role, ok := a.roles[name]
+	if !ok {
+		role = a.defaultRole
+		if claimedRoles := getClaimedRoles(claims, a.rolesClaim); len(claimedRoles) > 0 {
+			role = RoleViewer
+
+			for _, claimedRole := range claimedRoles {
+				if claimedRole == RoleAdmin {
+					role = RoleAdmin
+
+					break
+				}
+			}
+		}
+	}
+
+	return Principal{
+		Name: name,
+		Role: role,
+	}, nil
+}
+
+func (a *oidcAuthenticator) Challenge() string {
+	return `Bearer realm="hTorrent"`
+}
+
+func getClaimedRoles(claims map[string]any, rolesClaim string) []Role {
+	if strings.TrimSpace(rolesClaim) == "" {
+		return []Role{}
+	}
+
+	var value any = claims
+	for _, key := range strings.Split(rolesClaim, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return []Role{}
+		}
+
+		value = m[key]
+	}
+
+	rawRoles := []string{}
+	switch v := value.(type) {
+	case string:
+		rawRoles = append(rawRoles, strings.Fields(v)...)
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				rawRoles = append(rawRoles, s)
+			}
+		}
+	}
+
+	roles := []Role{}
+	for _, rawRole := range rawRoles {
+		if role, err := ParseRole(rawRole); err == nil {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+func getCredentials(r *http.Request) (username string, token string, ok bool) {
+	if header := r.Header.Get("Authorization"); len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", strings.TrimSpace(header[len(bearerPrefix):]), true
+	}
+
+	return r.BasicAuth()
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+	"golang.org/x/time/rate"
+)
+
+const (
+	bandwidthCheckInterval = time.Millisecond * 250
+	minRateLimiterBurst    = 1 << 20
+)
+
+var (
+	ErrInvalidBandwidthSchedule = errors.New("invalid bandwidth schedule, expected start-end=download/upload (i.e. 01:00-07:00=0/0)")
+)
+
+type Bandwidth struct {
+	DownloadRate int
+	UploadRate   int
+	Schedule     []BandwidthSchedule
+}
+
+type BandwidthSchedule struct {
+	Start        time.Duration
+	End          time.Duration
+	DownloadRate int
+	UploadRate   int
+}
+
+func ParseBandwidthSchedule(schedule string) (BandwidthSchedule, error) {
+	rawTimes, rawRates, ok := strings.Cut(strings.TrimSpace(schedule), "=")
+	if !ok {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, schedule)
+	}
+
+	rawStart, rawEnd, ok := strings.Cut(rawTimes, "-")
+	if !ok {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, schedule)
+	}
+
+	rawDownloadRate, rawUploadRate, ok := strings.Cut(rawRates, "/")
+	if !ok {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, schedule)
+	}
+
+	start, err := time.Parse("15:04", rawStart)
+	if err != nil {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, err)
+	}
+
+	end, err := time.Parse("15:04", rawEnd)
+	if err != nil {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, err)
+	}
+
+	downloadRate, err := strconv.Atoi(rawDownloadRate)
+	if err != nil {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, err)
+	}
+
+	uploadRate, err := strconv.Atoi(rawUploadRate)
+	if err != nil {
+		return BandwidthSchedule{}, fmt.Errorf("%w: %v", ErrInvalidBandwidthSchedule, err)
+	}
+
+	return BandwidthSchedule{
+		Start:        time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:          time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		DownloadRate: downloadRate,
+		UploadRate:   uploadRate,
+	}, nil
+}
+
+func (s BandwidthSchedule) isActive(now time.Time) bool {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	sinceMidnight := now.Sub(midnight)
+
+	if s.Start <= s.End {
+		return sinceMidnight >= s.Start && sinceMidnight < s.End
+	}
+
+	return sinceMidnight >= s.Start || sinceMidnight < s.End
+}
+
+func (b Bandwidth) getRates(now time.Time) (downloadRate int, uploadRate int, scheduled bool) {
+	for _, s := range b.Schedule {
+		if s.isActive(now) {
+			return s.DownloadRate, s.UploadRate, true
+		}
+	}
+
+	return b.DownloadRate, b.UploadRate, false
+}
+
+func newRateLimiter(bytesPerSecond int) *rate.Limiter {
+	l := rate.NewLimiter(rate.Inf, minRateLimiterBurst)
+	setRateLimit(l, bytesPerSecond)
+
+	return l
+}
+
+func setRateLimit(l *rate.Limiter, bytesPerSecond int) {
+	if bytesPerSecond <= 0 {
+		l.SetLimit(rate.Inf)
+
+		return
+	}
+
+	burst := bytesPerSecond
+	if burst < minRateLimiterBurst {
+		burst = minRateLimiterBurst
+	}
+
+	l.SetBurst(burst)
+	l.SetLimit(rate.Limit(bytesPerSecond))
+}
+
+type torrentThrottle struct {
+	downloadRate int
+	uploadRate   int
+
+	lastCheck      time.Time
+	lastDownloaded int64
+	lastUploaded   int64
+
+	downloadAllowance float64
+	uploadAllowance   float64
+
+	downloadThrottled bool
+	uploadThrottled   bool
+}
+
+func (t *torrentThrottle) update(now time.Time, downloaded, uploaded int64) (downloadChanged bool, uploadChanged bool) {
+	elapsed := now.Sub(t.lastCheck).Seconds()
+	if t.lastCheck.IsZero() {
+		elapsed = 0
+	}
+
+	downloadThrottled := applyThrottle(&t.downloadAllowance, t.downloadRate, elapsed, downloaded-t.lastDownloaded)
+	uploadThrottled := applyThrottle(&t.uploadAllowance, t.uploadRate, elapsed, uploaded-t.lastUploaded)
+
+	downloadChanged = downloadThrottled != t.downloadThrottled
+	uploadChanged = uploadThrottled != t.uploadThrottled
+
+	t.lastCheck = now
+	t.lastDownloaded = downloaded
+	t.lastUploaded = uploaded
+	t.downloadThrottled = downloadThrottled
+	t.uploadThrottled = uploadThrottled
+
+	return downloadChanged, uploadChanged
+}
+
+func applyThrottle(allowance *float64, bytesPerSecond int, elapsed float64, transferred int64) bool {
+	if bytesPerSecond <= 0 {
+		*allowance = 0
+
+		return false
+	}
+
+	*allowance += float64(bytesPerSecond)*elapsed - float64(transferred)
+	if *allowance > float64(bytesPerSecond) {
+		*allowance = float64(bytesPerSecond)
+	}
+
+	return *allowance < 0
+}
+
+func (b Bandwidth) isSet() bool {
+	return b.DownloadRate != 0 || b.UploadRate != 0 || len(b.Schedule) > 0
+}
+
+func (g *Gateway) canLimitBandwidth() bool {
+	return g.downloadLimiter != nil && g.uploadLimiter != nil
+}
+
+func (g *Gateway) getBandwidth() v1.Bandwidth {
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	downloadRate, uploadRate, scheduled := g.bandwidth.getRates(time.Now())
+
+	return v1.Bandwidth{
+		DownloadRate: downloadRate,
+		UploadRate:   uploadRate,
+		Scheduled:    scheduled,
+	}
+}
+
+func (g *Gateway) setBandwidth(downloadRate, uploadRate *int) {
+	g.bandwidthLock.Lock()
+	if downloadRate != nil {
+		g.bandwidth.DownloadRate = *downloadRate
+	}
+
+	if uploadRate != nil {
+		g.bandwidth.UploadRate = *uploadRate
+	}
+	g.bandwidthLock.Unlock()
+
+	g.applyBandwidth()
+}
+
+func (g *Gateway) applyBandwidth() {
+	if !g.canLimitBandwidth() {
+		return
+	}
+
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	downloadRate, uploadRate, scheduled := g.bandwidth.getRates(time.Now())
+	if downloadRate == g.appliedDownloadRate && uploadRate == g.appliedUploadRate {
+		return
+	}
+
+	g.log.Debug().
+		Int("downloadRate", downloadRate).
+		Int("uploadRate", uploadRate).
+		Bool("scheduled", scheduled).
+		Msg("Applying bandwidth limits")
+
+	setRateLimit(g.downloadLimiter, downloadRate)
+	setRateLimit(g.uploadLimiter, uploadRate)
+
+	g.appliedDownloadRate = downloadRate
+	g.appliedUploadRate = uploadRate
+}
+
+func (g *Gateway) getTorrentBandwidth(infoHash metainfo.Hash) (downloadRate int, uploadRate int) {
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	throttle, ok := g.throttles[infoHash]
+	if !ok {
+		return 0, 0
+	}
+
+	return throttle.downloadRate, throttle.uploadRate
+}
+
+func (g *Gateway) setTorrentBandwidth(t *torrent.Torrent, downloadRate, uploadRate int) error {
+	g.restoreTorrentBandwidth(t.InfoHash(), downloadRate, uploadRate)
+
+	g.updateDownload(t)
+	g.updateUpload(t)
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.DownloadRate = downloadRate
+		st.UploadRate = uploadRate
+	})
+}
+
+func (g *Gateway) restoreTorrentBandwidth(infoHash metainfo.Hash, downloadRate, uploadRate int) {
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	if downloadRate <= 0 && uploadRate <= 0 {
+		delete(g.throttles, infoHash)
+
+		return
+	}
+
+	throttle, ok := g.throttles[infoHash]
+	if !ok {
+		throttle = &torrentThrottle{}
+
+		g.throttles[infoHash] = throttle
+	}
+
+	throttle.downloadRate = downloadRate
+	throttle.uploadRate = uploadRate
+}
+
+func (g *Gateway) forgetTorrentBandwidth(infoHash metainfo.Hash) {
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	delete(g.throttles, infoHash)
+}
+
+func (g *Gateway) isThrottled(infoHash metainfo.Hash) (download bool, upload bool) {
+	g.bandwidthLock.Lock()
+	defer g.bandwidthLock.Unlock()
+
+	throttle, ok := g.throttles[infoHash]
+	if !ok {
+		return false, false
+	}
+
+	return throttle.downloadThrottled, throttle.uploadThrottled
+}
+
+func (g *Gateway) monitorBandwidth() {
+	tick := time.NewTicker(bandwidthCheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.closed:
+			return
+		case now := <-tick.C:
+			g.applyBandwidth()
+
+			for _, t := range g.torrentClient.Torrents() {
+				stats := t.Stats()
+
+				g.bandwidthLock.Lock()
+				throttle, ok := g.throttles[t.InfoHash()]
+				if !ok {
+					g.bandwidthLock.Unlock()
+
+					continue
+				}
+
+				downloadChanged, uploadChanged := throttle.update(now, stats.BytesReadData.Int64(), stats.BytesWrittenData.Int64())
+				g.bandwidthLock.Unlock()
+
+				if downloadChanged {
+					g.updateDownload(t)
+				}
+
+				if uploadChanged {
+					g.updateUpload(t)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,615 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	TorrentVersionV1     = "v1"
+	TorrentVersionV2     = "v2"
+	TorrentVersionHybrid = "hybrid"
+
+	createdBy = "htorrent"
+)
+
+var (
+	ErrUnknownTorrentVersion    = errors.New("unknown torrent version")
+	ErrInvalidPieceLength       = errors.New("invalid piece length, must be a power of two and at least 16 KiB")
+	ErrMissingSeedDirectory     = errors.New("missing seed directory")
+	ErrPathOutsideSeedDirectory = errors.New("path is outside of the seed directory")
+	ErrNoFilesToCreateFrom      = errors.New("could not find any files to create the torrent from")
+)
+
+type CreateOptions struct {
+	Version     string
+	PieceLength int64
+	Trackers    []string
+	WebSeeds    []string
+	Comment     string
+	Private     bool
+}
+
+type createFile struct {
+	path   []string
+	source string
+	length int64
+}
+
+func CreateTorrent(root string, opts CreateOptions) (*metainfo.MetaInfo, error) {
+	files, err := getCreateFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	totalLength := int64(0)
+	for _, f := range files {
+		totalLength += f.length
+	}
+
+	b, err := newTorrentBuilder(filepath.Base(root), totalLength, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if err := addCreateFile(b, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.metainfo()
+}
+
+func getCreateFiles(root string) ([]createFile, error) {
+	files := []createFile{}
+	if err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		filePath := []string{}
+		if p != root {
+			filePath = strings.Split(rel, string(filepath.Separator))
+		}
+
+		files = append(files, createFile{
+			path:   filePath,
+			source: p,
+			length: fi.Size(),
+		})
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, ErrNoFilesToCreateFrom
+	}
+
+	slices.SortFunc(files, func(a, b createFile) int {
+		return slices.Compare(a.path, b.path)
+	})
+
+	return files, nil
+}
+
+func addCreateFile(b *torrentBuilder, f createFile) error {
+	r, err := os.Open(f.source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	length, err := b.addFile(f.path, io.LimitReader(r, f.length))
+	if err != nil {
+		return err
+	}
+
+	if length != f.length {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+type torrentBuilder struct {
+	name        string
+	pieceLength int64
+	opts        CreateOptions
+	v1          bool
+	v2          bool
+
+	hasher      *pieceHasher
+	padding     int64
+	files       []map[string]any
+	fileTree    map[string]any
+	pieceLayers map[string]string
+	length      int64
+	single      bool
+}
+
+func newTorrentBuilder(name string, totalLength int64, opts CreateOptions) (*torrentBuilder, error) {
+	switch opts.Version {
+	case "", TorrentVersionV1, TorrentVersionV2, TorrentVersionHybrid:
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownTorrentVersion, opts.Version)
+	}
+
+	pieceLength := opts.PieceLength
+	if pieceLength == 0 {
+		pieceLength = metainfo.ChoosePieceLength(totalLength)
+	}
+
+	if pieceLength < merkle.BlockSize || bits.OnesCount64(uint64(pieceLength)) != 1 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPieceLength, pieceLength)
+	}
+
+	return &torrentBuilder{
+		name:        name,
+		pieceLength: pieceLength,
+		opts:        opts,
+		v1:          opts.Version != TorrentVersionV2,
+		v2:          opts.Version == TorrentVersionV2 || opts.Version == TorrentVersionHybrid,
+
+		hasher:      newPieceHasher(pieceLength, sha1.New()),
+		files:       []map[string]any{},
+		fileTree:    map[string]any{},
+		pieceLayers: map[string]string{},
+	}, nil
+}
+
+func (b *torrentBuilder) addFile(filePath []string, r io.Reader) (int64, error) {
+	if b.padding > 0 {
+		if _, err := b.hasher.Write(make([]byte, b.padding)); err != nil {
+			return 0, err
+		}
+
+		b.files = append(b.files, map[string]any{
+			"attr":   "p",
+			"length": b.padding,
+			"path":   []string{".pad", strconv.FormatInt(b.padding, 10)},
+		})
+
+		b.padding = 0
+	}
+
+	writers := []io.Writer{}
+	if b.v1 {
+		writers = append(writers, b.hasher)
+	}
+
+	var (
+		fileHash hash.Hash
+		layer    *pieceHasher
+	)
+	if b.v2 {
+		fileHash = merkle.NewHash()
+		layer = newPieceHasher(b.pieceLength, merkle.NewHash())
+
+		writers = append(writers, fileHash, layer)
+	}
+
+	length, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return 0, err
+	}
+
+	b.length += length
+	b.single = len(filePath) == 0
+
+	if b.v1 && len(filePath) > 0 {
+		b.files = append(b.files, map[string]any{
+			"length": length,
+			"path":   filePath,
+		})
+	}
+
+	if !b.v2 {
+		return length, nil
+	}
+
+	properties := map[string]any{
+		"length": length,
+	}
+
+	if length > 0 {
+		piecesRoot := string(fileHash.Sum(nil))
+		properties["pieces root"] = piecesRoot
+
+		if length > b.pieceLength {
+			b.pieceLayers[piecesRoot] = string(layer.sum())
+		}
+	}
+
+	treePath := filePath
+	if len(treePath) == 0 {
+		treePath = []string{b.name}
+	}
+
+	dir := b.fileTree
+	for _, component := range treePath {
+		sub, ok := dir[component].(map[string]any)
+		if !ok {
+			sub = map[string]any{}
+
+			dir[component] = sub
+		}
+
+		dir = sub
+	}
+	dir[metainfo.FileTreePropertiesKey] = properties
+
+	if b.v1 {
+		b.padding = (b.pieceLength - length%b.pieceLength) % b.pieceLength
+	}
+
+	return length, nil
+}
+
+func (b *torrentBuilder) metainfo() (*metainfo.MetaInfo, error) {
+	info := map[string]any{
+		"name":         b.name,
+		"piece length": b.pieceLength,
+	}
+
+	if b.v1 {
+		info["pieces"] = string(b.hasher.sum())
+
+		if b.single {
+			info["length"] = b.length
+		} else {
+			info["files"] = b.files
+		}
+	}
+
+	if b.v2 {
+		info["meta version"] = 2
+		info["file tree"] = b.fileTree
+	}
+
+	if b.opts.Private {
+		info["private"] = 1
+	}
+
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	mi := &metainfo.MetaInfo{
+		InfoBytes:    infoBytes,
+		Comment:      b.opts.Comment,
+		CreatedBy:    createdBy,
+		CreationDate: time.Now().Unix(),
+		UrlList:      b.opts.WebSeeds,
+	}
+
+	if b.v2 {
+		mi.PieceLayers = b.pieceLayers
+	}
+
+	trackers := []string{}
+	for _, tracker := range b.opts.Trackers {
+		if tracker = strings.TrimSpace(tracker); tracker != "" {
+			trackers = append(trackers, tracker)
+		}
+	}
+
+	if len(trackers) > 0 {
+		mi.Announce = trackers[0]
+		mi.AnnounceList = metainfo.AnnounceList{trackers}
+	}
+
+	return mi, nil
+}
+
+type pieceHasher struct {
+	pieceLength int64
+	written     int64
+	hash        hash.Hash
+	sums        []byte
+}
+
+func newPieceHasher(pieceLength int64, h hash.Hash) *pieceHasher {
+	return &pieceHasher{
+		pieceLength: pieceLength,
+		hash:        h,
+	}
+}
+
+func (h *pieceHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := min(int64(len(p)), h.pieceLength-h.written)
+
+		h.hash.Write(p[:chunk])
+		h.written += chunk
+		p = p[chunk:]
+
+		if h.written == h.pieceLength {
+			h.sums = h.hash.Sum(h.sums)
+			h.hash.Reset()
+			h.written = 0
+		}
+	}
+
+	return n, nil
+}
+
+func (h *pieceHasher) sum() []byte {
+	if h.written > 0 {
+		if m, ok := h.hash.(*merkle.Hash); ok {
+			h.sums = m.SumMinLength(h.sums, int(h.pieceLength))
+		} else {
+			h.sums = h.hash.Sum(h.sums)
+		}
+
+		h.hash.Reset()
+		h.written = 0
+	}
+
+	return h.sums
+}
+
+func (g *Gateway) getSeedPath(rawPath string) (string, error) {
+	if strings.TrimSpace(g.seedDir) == "" {
+		return "", ErrMissingSeedDirectory
+	}
+
+	root, err := filepath.Abs(g.seedDir)
+	if err != nil {
+		return "", err
+	}
+
+	p := filepath.Join(root, filepath.FromSlash(path.Clean("/"+rawPath)))
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return "", err
+	}
+
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %v", ErrPathOutsideSeedDirectory, rawPath)
+	}
+
+	return p, nil
+}
+
+func newSeedStorage(root string) (storage.ClientImplCloser, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(root)
+	isDir := stat.IsDir()
+
+	return storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: filepath.Dir(root),
+		TorrentDirMaker: func(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string {
+			return baseDir
+		},
+		FilePathMaker: func(opts storage.FilePathMakerOpts) string {
+			if !isDir {
+				return name
+			}
+
+			return filepath.Join(append([]string{name}, opts.File.BestPath()...)...)
+		},
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	}), nil
+}
+
+func (g *Gateway) seedTorrent(mi *metainfo.MetaInfo, root string) (*torrent.Torrent, error) {
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return nil, err
+	}
+	spec.Storage, err = newSeedStorage(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := g.addTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	g.network.addTrackers(t)
+
+	go t.VerifyData()
+
+	return t, nil
+}
+
+func getCreateOptions(w http.ResponseWriter, r *http.Request) CreateOptions {
+	opts := CreateOptions{
+		Version:  r.URL.Query().Get("version"),
+		Trackers: r.URL.Query()["tracker"],
+		Comment:  r.URL.Query().Get("comment"),
+	}
+
+	var err error
+	if rawPieceLength := r.URL.Query().Get("pieceLength"); rawPieceLength != "" {
+		opts.PieceLength, err = strconv.ParseInt(rawPieceLength, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+	}
+
+	if rawPrivate := r.URL.Query().Get("private"); rawPrivate != "" {
+		opts.Private, err = strconv.ParseBool(rawPrivate)
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+	}
+
+	for _, rawWebSeed := range r.URL.Query()["webSeed"] {
+		webSeed, err := ParseWebSeed(rawWebSeed)
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+
+		opts.WebSeeds = append(opts.WebSeeds, webSeed)
+	}
+
+	return opts
+}
+
+func (g *Gateway) checkCreatedTorrent(w http.ResponseWriter, r *http.Request, principal Principal, mi *metainfo.MetaInfo) {
+	g.reloadLock.RLock()
+	policy := g.policy
+	g.reloadLock.RUnlock()
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		panic(err)
+	}
+
+	infoHash, infoHashV2, err := getMetainfoInfoHashes(mi)
+	if err != nil {
+		panic(err)
+	}
+
+	magnetLink, err := getMagnet(*mi)
+	if err != nil {
+		panic(err)
+	}
+
+	err = policy.CheckInfoHashes(infoHash, infoHashV2)
+	if err == nil {
+		err = policy.CheckInfo(&info)
+	}
+
+	if err != nil {
+		g.rejectTorrent(w, r, principal, magnetLink, infoHash, err)
+	}
+}
+
+func (g *Gateway) publishTorrent(w http.ResponseWriter, r *http.Request, principal Principal, action string, mi *metainfo.MetaInfo, root string) {
+	t, err := g.seedTorrent(mi, root)
+	if err != nil {
+		panic(err)
+	}
+
+	magnetLink, err := getMagnet(*mi)
+	if err != nil {
+		panic(err)
+	}
+
+	g.audit(r, principal, v1.AuditEvent{
+		Action:   action,
+		Magnet:   magnetLink,
+		InfoHash: t.InfoHash().HexString(),
+	})
+
+	if err := g.persistCreatedTorrent(t, mi, magnetLink, root); err != nil {
+		g.log.Error().
+			Err(err).
+			Str("magnet", magnetLink).
+			Msg("Could not persist torrent")
+	}
+
+	if err := g.registerTorrent(t); err != nil {
+		g.log.Error().
+			Err(err).
+			Str("magnet", magnetLink).
+			Msg("Could not register torrent")
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(g.getCreatedTorrent(r, t, magnetLink)); err != nil {
+		panic(err)
+	}
+}
+
+func (g *Gateway) persistCreatedTorrent(t *torrent.Torrent, mi *metainfo.MetaInfo, magnetLink string, root string) error {
+	if g.session == nil {
+		return nil
+	}
+
+	encoded, err := encodeMetainfo(*mi)
+	if err != nil {
+		return err
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.Magnet = magnetLink
+		st.Metainfo = encoded
+		st.SeedPath = root
+	})
+}
+
+func (g *Gateway) getStreamURL(r *http.Request, magnetLink string, filePath string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   strings.TrimSuffix(g.basePath, "/") + "/stream",
+	}
+
+	q := u.Query()
+	q.Set("magnet", magnetLink)
+	q.Set("path", filePath)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (g *Gateway) getCreatedTorrent(r *http.Request, t *torrent.Torrent, magnetLink string) v1.CreatedTorrent {
+	streams := []v1.Stream{}
+	for _, f := range t.Files() {
+		streams = append(streams, v1.Stream{
+			Path: f.Path(),
+			URL:  g.getStreamURL(r, magnetLink, f.Path()),
+		})
+	}
+
+	return v1.CreatedTorrent{
+		Magnet:  magnetLink,
+		Info:    getInfo(t),
+		Streams: streams,
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const testPieceLength = 32 * 1024
+
+func writeTestFiles(t *testing.T, root string, files map[string]int) {
+	rng := rand.New(rand.NewSource(1))
+
+	for name, length := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		data := make([]byte, length)
+		_, _ = rng.Read(data)
+
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func verifyCreatedTorrent(t *testing.T, root string, mi *metainfo.MetaInfo) {
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec.Storage, err = newSeedStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisablePEX = true
+	cfg.NoUpload = true
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tor, _, err := client.AddTorrentSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tor.VerifyData()
+
+	if completed, length := tor.BytesCompleted(), tor.Length(); completed != length {
+		t.Fatalf("expected all %v bytes to verify against the created torrent, got %v", length, completed)
+	}
+}
+
+func TestCreateTorrentRoundTrip(t *testing.T) {
+	files := map[string]int{
+		"a.bin":     1,
+		"sub/b.bin": testPieceLength,
+		"sub/c.bin": 3*testPieceLength + 100,
+		"d.bin":     testPieceLength + testPieceLength/4,
+	}
+
+	for _, version := range []string{TorrentVersionV1, TorrentVersionV2, TorrentVersionHybrid} {
+		for _, single := range []bool{false, true} {
+			name := version + "/dir"
+			if single {
+				name = version + "/file"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				root := filepath.Join(t.TempDir(), "content")
+				if single {
+					writeTestFiles(t, filepath.Dir(root), map[string]int{
+						"content": 5*testPieceLength + 1,
+					})
+				} else {
+					writeTestFiles(t, root, files)
+				}
+
+				mi, err := CreateTorrent(root, CreateOptions{
+					Version:     version,
+					PieceLength: testPieceLength,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+				if err := mi.Write(&buf); err != nil {
+					t.Fatal(err)
+				}
+
+				mi, err = metainfo.Load(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				info, err := mi.UnmarshalInfo()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got, want := info.HasV1(), version != TorrentVersionV2; got != want {
+					t.Fatalf("expected HasV1() to be %v, got %v", want, got)
+				}
+
+				if got, want := info.HasV2(), version != TorrentVersionV1; got != want {
+					t.Fatalf("expected HasV2() to be %v, got %v", want, got)
+				}
+
+				if info.HasV2() {
+					if err := metainfo.ValidatePieceLayers(mi.PieceLayers, &info.FileTree, info.PieceLength); err != nil {
+						t.Fatal(err)
+					}
+
+					for _, f := range info.UpvertedFiles() {
+						if f.Length > 0 && !f.PiecesRoot.Ok {
+							t.Fatalf("missing pieces root for %v", f.Path)
+						}
+					}
+				}
+
+				verifyCreatedTorrent(t, root, mi)
+			})
+		}
+	}
+}
+
+func TestGetSeedPath(t *testing.T) {
+	root := t.TempDir()
+
+	g := &Gateway{
+		seedDir: root,
+	}
+
+	for rawPath, want := range map[string]string{
+		"a":          filepath.Join(root, "a"),
+		"..a":        filepath.Join(root, "..a"),
+		"sub/..b":    filepath.Join(root, "sub", "..b"),
+		"../a":       filepath.Join(root, "a"),
+		"/etc/hosts": filepath.Join(root, "etc", "hosts"),
+	} {
+		got, err := g.getSeedPath(rawPath)
+		if err != nil {
+			t.Fatalf("%v: %v", rawPath, err)
+		}
+
+		if got != want {
+			t.Fatalf("%v: expected %v, got %v", rawPath, want, got)
+		}
+	}
+
+	for _, rawPath := range []string{"", ".", "..", "a/../.."} {
+		if _, err := g.getSeedPath(rawPath); !errors.Is(err, ErrPathOutsideSeedDirectory) {
+			t.Fatalf("%v: expected %v, got %v", rawPath, ErrPathOutsideSeedDirectory, err)
+		}
+	}
+}
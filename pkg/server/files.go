@@ -0,0 +1,242 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrInvalidFileIndex  = errors.New("invalid file index")
+	ErrInvalidSelectOnly = errors.New("invalid list of selected files")
+	ErrFileNotSelected   = errors.New("file was not selected in the magnet link")
+)
+
+type fileRange struct {
+	first int
+	last  int
+}
+
+type fileSelection []fileRange
+
+func (s fileSelection) contains(index int) bool {
+	for _, r := range s {
+		if index >= r.first && index <= r.last {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s fileSelection) String() string {
+	rawRanges := []string{}
+	for _, r := range s {
+		if r.first == r.last {
+			rawRanges = append(rawRanges, strconv.Itoa(r.first))
+		} else {
+			rawRanges = append(rawRanges, fmt.Sprintf("%v-%v", r.first, r.last))
+		}
+	}
+
+	return strings.Join(rawRanges, ",")
+}
+
+func parseFileIndex(rawIndex string) (int, error) {
+	index, err := strconv.Atoi(strings.TrimSpace(rawIndex))
+	if err != nil || index < 0 {
+		return -1, fmt.Errorf("%w: %v", ErrInvalidFileIndex, rawIndex)
+	}
+
+	return index, nil
+}
+
+func parseSelectOnly(rawSelectOnly string) (fileSelection, error) {
+	selection := fileSelection{}
+	for _, rawRange := range strings.Split(rawSelectOnly, ",") {
+		rawFirst, rawLast, isRange := strings.Cut(rawRange, "-")
+
+		first, err := parseFileIndex(rawFirst)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSelectOnly, rawSelectOnly)
+		}
+
+		last := first
+		if isRange {
+			last, err = parseFileIndex(rawLast)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSelectOnly, rawSelectOnly)
+			}
+		}
+
+		selection = append(selection, fileRange{
+			first: first,
+			last:  last,
+		})
+	}
+
+	return selection, nil
+}
+
+func getSelectOnly(magnetLink string) (fileSelection, error) {
+	m, err := metainfo.ParseMagnetV2Uri(magnetLink)
+	if err != nil {
+		return nil, err
+	}
+
+	rawSelectOnly := m.Params.Get("so")
+	if rawSelectOnly == "" {
+		return nil, nil
+	}
+
+	return parseSelectOnly(rawSelectOnly)
+}
+
+func findFile(t *torrent.Torrent, index int, path string) (*torrent.File, int) {
+	files := t.Files()
+	if index >= 0 {
+		if index >= len(files) {
+			return nil, -1
+		}
+
+		return files[index], index
+	}
+
+	path = norm.NFC.String(path)
+	for i, f := range files {
+		if norm.NFC.String(f.Path()) == path {
+			return f, i
+		}
+	}
+
+	return nil, -1
+}
+
+func (g *Gateway) selectFiles(t *torrent.Torrent, selection fileSelection) error {
+	if selection == nil {
+		return nil
+	}
+
+	g.selectionsLock.Lock()
+	g.selections[t.InfoHash()] = selection
+	g.selectionsLock.Unlock()
+
+	priorities := map[int]string{}
+	for i, f := range t.Files() {
+		priority := types.PiecePriorityNone
+		if selection.contains(i) {
+			priority = types.PiecePriorityNormal
+		}
+
+		f.SetPriority(priority)
+		priorities[i] = formatPriority(priority)
+	}
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.Priorities = priorities
+		st.SelectOnly = selection.String()
+	})
+}
+
+func (g *Gateway) getUnselectedFiles(t *torrent.Torrent, selection fileSelection) []int {
+	g.selectionsLock.Lock()
+	defer g.selectionsLock.Unlock()
+
+	current, ok := g.selections[t.InfoHash()]
+	if selection == nil || !ok {
+		return nil
+	}
+
+	indexes := []int{}
+	for i := range t.Files() {
+		if selection.contains(i) && !current.contains(i) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+func (g *Gateway) mergeSelection(t *torrent.Torrent, indexes []int) error {
+	for _, index := range indexes {
+		if err := g.setPriority(t, index, types.PiecePriorityNormal); err != nil {
+			return err
+		}
+
+		if err := g.selectFile(t, index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) selectFile(t *torrent.Torrent, index int) error {
+	g.selectionsLock.Lock()
+	selection, ok := g.selections[t.InfoHash()]
+	if !ok || selection.contains(index) {
+		g.selectionsLock.Unlock()
+
+		return nil
+	}
+
+	selection = append(slices.Clip(selection), fileRange{
+		first: index,
+		last:  index,
+	})
+	g.selections[t.InfoHash()] = selection
+	g.selectionsLock.Unlock()
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.SelectOnly = selection.String()
+	})
+}
+
+func (g *Gateway) isSelected(infoHash metainfo.Hash, index int) bool {
+	g.selectionsLock.Lock()
+	defer g.selectionsLock.Unlock()
+
+	selection, ok := g.selections[infoHash]
+
+	return !ok || selection.contains(index)
+}
+
+func (g *Gateway) restoreSelection(infoHash metainfo.Hash, rawSelectOnly string) error {
+	if rawSelectOnly == "" {
+		return nil
+	}
+
+	selection, err := parseSelectOnly(rawSelectOnly)
+	if err != nil {
+		return err
+	}
+
+	g.selectionsLock.Lock()
+	defer g.selectionsLock.Unlock()
+
+	g.selections[infoHash] = selection
+
+	return nil
+}
+
+func (g *Gateway) forgetSelection(infoHash metainfo.Hash) {
+	g.selectionsLock.Lock()
+	defer g.selectionsLock.Unlock()
+
+	delete(g.selections, infoHash)
+}
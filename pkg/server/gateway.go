@@ -7,115 +7,381 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
-	"github.com/phayes/freeport"
+	"github.com/anacrolix/torrent/tracker"
 	"github.com/pojntfx/go-auth-utils/pkg/authn"
 	"github.com/pojntfx/go-auth-utils/pkg/authn/basic"
-	"github.com/pojntfx/go-auth-utils/pkg/authn/oidc"
 	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
 )
 
 var (
 	ErrEmptyMagnetLink  = errors.New("could not work with empty magnet link")
 	ErrEmptyPath        = errors.New("could not work with empty path")
 	ErrCouldNotFindPath = errors.New("could not find path in torrent")
+	ErrUnknownTorrent   = errors.New("could not find torrent")
+	ErrEmptyUpdate      = errors.New("could not work with empty update")
+
+	ErrUnsupportedWithTorrentClient       = errors.New("bandwidth limits and network settings can't be used with an injected torrent client")
+	ErrUnsupportedWithTorrentClientConfig = errors.New("network settings can't be used with an injected torrent client config")
 )
 
+type GatewayConfig struct {
+	LAddr           string
+	BasePath        string
+	Storage         string
+	StorageType     string
+	StorageCapacity int64
+	SeedDir         string
+	S3              S3
+	SessionPath     string
+	APIUsername     string
+	APIPassword     string
+	UsersFile       string
+	OIDCIssuer      string
+	OIDCClientID    string
+	RolesFile       string
+	PolicyFile      string
+	RolesClaim      string
+	DefaultRole     Role
+	Limits          Limits
+	Seeding         Seeding
+	Bandwidth       Bandwidth
+	Network         Network
+	TLS             TLS
+	Cluster         Cluster
+	AuditLog        *AuditLog
+	Debug           bool
+
+	ProgressInterval time.Duration
+
+	Authenticator       Authenticator
+	StorageBackend      storage.ClientImplCloser
+	Registry            Registry
+	TorrentClientConfig *torrent.ClientConfig
+	TorrentClient       *torrent.Client
+	Middlewares         []func(http.Handler) http.Handler
+	Logger              *zerolog.Logger
+
+	OnDownloadProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics)
+}
+
 type Gateway struct {
-	laddr        string
-	storage      string
-	apiUsername  string
-	apiPassword  string
-	oidcIssuer   string
-	oidcClientID string
-	debug        bool
+	laddr           string
+	basePath        string
+	storage         string
+	storageType     string
+	storageCapacity int64
+	seedDir         string
+	s3              S3
+	sessionPath     string
+	apiUsername     string
+	apiPassword     string
+	usersFile       string
+	oidcIssuer      string
+	oidcClientID    string
+	rolesFile       string
+	policyFile      string
+	rolesClaim      string
+	defaultRole     Role
+	limits          Limits
+	seeding         Seeding
+	bandwidth       Bandwidth
+	network         Network
+	tls             TLS
+	cluster         Cluster
+	auditLog        *AuditLog
+	debug           bool
+
+	authenticator       Authenticator
+	storageBackend      storage.ClientImplCloser
+	registry            Registry
+	torrentClientConfig *torrent.ClientConfig
+	middlewares         []func(http.Handler) http.Handler
+	log                 zerolog.Logger
+
+	progress *progressTracker
+
+	torrentClient     *torrent.Client
+	ownsTorrentClient bool
+	trackerClientOpts tracker.NewClientOpts
+	storageCloser     storage.ClientImplCloser
+	ownsRegistry      bool
+	session           *session
+	paused            map[metainfo.Hash]bool
+	pausedLock        sync.Mutex
+	seedingStates     map[metainfo.Hash]*seedingState
+	seedingLock       sync.Mutex
+	throttles         map[metainfo.Hash]*torrentThrottle
+	sources           map[metainfo.Hash]*sourceStats
+	sourcesLock       sync.Mutex
+	peerStats         map[*torrent.PeerConn]*peerStats
+	peerStatsLock     sync.Mutex
+	trackers          map[metainfo.Hash]map[string]*trackerStatus
+	trackersLock      sync.Mutex
+	rates             map[metainfo.Hash]*torrentRates
+	ratesLock         sync.Mutex
+	streams           map[string]*activeStream
+	streamsLock       sync.Mutex
+	selections        map[metainfo.Hash]fileSelection
+	selectionsLock    sync.Mutex
+	pieceReaders      map[*pieceReader]struct{}
+	pieceReadersLock  sync.Mutex
+	bandwidthLock     sync.Mutex
+	mergeLock         sync.Mutex
+
+	downloadLimiter     *rate.Limiter
+	uploadLimiter       *rate.Limiter
+	appliedDownloadRate int
+	appliedUploadRate   int
+
+	srv        *http.Server
+	auth       Authenticator
+	reloadLock sync.RWMutex
+	challenge  string
+	roles      map[string]Role
+	policy     *Policy
+	limiter    *limiter
+
+	errs   chan error
+	closed chan struct{}
+	done   chan struct{}
 
-	onDownloadProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics)
+	ctx context.Context
+}
 
-	torrentClient *torrent.Client
-	srv           *http.Server
+func NewGateway(config GatewayConfig, ctx context.Context) *Gateway {
+	l := zlog.Logger
+	if config.Logger != nil {
+		l = *config.Logger
+	}
 
-	errs chan error
+	g := &Gateway{
+		laddr:           config.LAddr,
+		basePath:        config.BasePath,
+		storage:         config.Storage,
+		storageType:     config.StorageType,
+		storageCapacity: config.StorageCapacity,
+		seedDir:         config.SeedDir,
+		s3:              config.S3,
+		sessionPath:     config.SessionPath,
+		apiUsername:     config.APIUsername,
+		apiPassword:     config.APIPassword,
+		usersFile:       config.UsersFile,
+		oidcIssuer:      config.OIDCIssuer,
+		oidcClientID:    config.OIDCClientID,
+		rolesFile:       config.RolesFile,
+		policyFile:      config.PolicyFile,
+		rolesClaim:      config.RolesClaim,
+		defaultRole:     config.DefaultRole,
+		limits:          config.Limits,
+		seeding:         config.Seeding,
+		bandwidth:       config.Bandwidth,
+		network:         config.Network,
+		tls:             config.TLS,
+		cluster:         config.Cluster,
+		auditLog:        config.AuditLog,
+		debug:           config.Debug,
+
+		authenticator:       config.Authenticator,
+		storageBackend:      config.StorageBackend,
+		registry:            config.Registry,
+		torrentClientConfig: config.TorrentClientConfig,
+		middlewares:         config.Middlewares,
+		log:                 l,
+
+		torrentClient: config.TorrentClient,
+
+		paused:        map[metainfo.Hash]bool{},
+		seedingStates: map[metainfo.Hash]*seedingState{},
+		throttles:     map[metainfo.Hash]*torrentThrottle{},
+		sources:       map[metainfo.Hash]*sourceStats{},
+		peerStats:     map[*torrent.PeerConn]*peerStats{},
+		trackers:      map[metainfo.Hash]map[string]*trackerStatus{},
+		rates:         map[metainfo.Hash]*torrentRates{},
+		streams:       map[string]*activeStream{},
+		selections:    map[metainfo.Hash]fileSelection{},
+		pieceReaders:  map[*pieceReader]struct{}{},
+
+		errs:   make(chan error),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
 
-	ctx context.Context
+		ctx: ctx,
+	}
+
+	g.progress = newProgressTracker(config.ProgressInterval, g.getProgressMetrics, ctx)
+	if config.OnDownloadProgress != nil {
+		g.progress.subscribe(config.OnDownloadProgress)
+	}
+
+	return g
 }
 
-func NewGateway(
-	laddr string,
-	storage string,
-	apiUsername string,
-	apiPassword string,
-	oidcIssuer string,
-	oidcClientID string,
-	debug bool,
+func (g *Gateway) OpenHandler() (http.Handler, error) {
+	g.log.Trace().Msg("Opening gateway")
+
+	if g.defaultRole == "" {
+		if strings.TrimSpace(g.oidcIssuer) != "" || strings.TrimSpace(g.oidcClientID) != "" || strings.TrimSpace(g.tls.ClientCAFile) != "" {
+			return nil, ErrMissingDefaultRole
+		}
+
+		g.defaultRole = RoleAdmin
+	}
+
+	if g.torrentClient != nil {
+		if g.bandwidth.isSet() || g.network.isSet() {
+			return nil, ErrUnsupportedWithTorrentClient
+		}
+	} else {
+		var cfg *torrent.ClientConfig
+		if g.torrentClientConfig == nil {
+			cfg = torrent.NewDefaultClientConfig()
+			cfg.Debug = g.debug
+			cfg.Seed = true
+
+			if err := g.network.apply(cfg); err != nil {
+				return nil, err
+			}
+		} else {
+			if g.network.isSet() {
+				return nil, ErrUnsupportedWithTorrentClientConfig
+			}
 
-	onDownloadProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics),
+			c := *g.torrentClientConfig
+			c.Callbacks.ReceivedUsefulData = slices.Clone(c.Callbacks.ReceivedUsefulData)
 
-	ctx context.Context,
-) *Gateway {
-	return &Gateway{
-		laddr:        laddr,
-		storage:      storage,
-		apiUsername:  apiUsername,
-		apiPassword:  apiPassword,
-		oidcIssuer:   oidcIssuer,
-		oidcClientID: oidcClientID,
-		debug:        debug,
+			cfg = &c
+		}
 
-		onDownloadProgress: onDownloadProgress,
+		g.downloadLimiter = newRateLimiter(0)
+		g.uploadLimiter = newRateLimiter(0)
+		g.applyBandwidth()
 
-		errs: make(chan error),
+		cfg.DownloadRateLimiter = g.downloadLimiter
+		cfg.UploadRateLimiter = g.uploadLimiter
 
-		ctx: ctx,
-	}
-}
+		cfg.Callbacks.ReceivedUsefulData = append(cfg.Callbacks.ReceivedUsefulData, g.onReceivedUsefulData, g.onPeerReceivedUsefulData, g.onReceivedTransfer)
 
-func (g *Gateway) Open() error {
-	log.Trace().Msg("Opening gateway")
+		readMessage := cfg.Callbacks.ReadMessage
+		cfg.Callbacks.ReadMessage = func(pc *torrent.PeerConn, msg *pp.Message) {
+			if readMessage != nil {
+				readMessage(pc, msg)
+			}
+
+			g.onReadMessage(pc, msg)
+		}
 
-	cfg := torrent.NewDefaultClientConfig()
-	cfg.Debug = g.debug
-	cfg.DefaultStorage = storage.NewFileByInfoHash(g.storage)
+		peerConnClosed := cfg.Callbacks.PeerConnClosed
+		cfg.Callbacks.PeerConnClosed = func(pc *torrent.PeerConn) {
+			if peerConnClosed != nil {
+				peerConnClosed(pc)
+			}
 
-	torrentPort, err := freeport.GetFreePort()
-	if err != nil {
-		panic(err)
+			g.onPeerConnClosed(pc)
+		}
+
+		if g.storageBackend != nil {
+			cfg.DefaultStorage = g.storageBackend
+		} else if cfg.DefaultStorage == nil {
+			storageCloser, err := NewStorage(g.storageType, g.storage, g.storageCapacity, g.s3)
+			if err != nil {
+				return nil, err
+			}
+
+			g.storageCloser = storageCloser
+			cfg.DefaultStorage = g.storageCloser
+		}
+
+		c, err := torrent.NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		g.torrentClient = c
+		g.trackerClientOpts = getTrackerClientOpts(cfg)
+		g.ownsTorrentClient = true
 	}
-	cfg.ListenPort = torrentPort
 
-	c, err := torrent.NewClient(cfg)
-	if err != nil {
-		return err
+	g.log.Debug().
+		Int("port", g.torrentClient.LocalPort()).
+		Msg("Listening for peers")
+
+	if strings.TrimSpace(g.sessionPath) != "" {
+		g.session = newSession(g.sessionPath)
+
+		if err := g.session.open(); err != nil {
+			return nil, err
+		}
+
+		if err := g.restoreTorrents(); err != nil {
+			return nil, err
+		}
 	}
-	g.torrentClient = c
 
-	var auth authn.Authn
-	if strings.TrimSpace(g.oidcIssuer) == "" && strings.TrimSpace(g.oidcClientID) == "" {
-		auth = basic.NewAuthn(g.apiUsername, g.apiPassword)
-	} else {
-		auth = oidc.NewAuthn(g.oidcIssuer, g.oidcClientID)
+	if g.registry != nil || strings.TrimSpace(g.cluster.Registry) != "" {
+		if err := g.cluster.validate(); err != nil {
+			return nil, err
+		}
+
+		if g.registry == nil {
+			registry, err := NewRegistry(g.cluster.Registry)
+			if err != nil {
+				return nil, err
+			}
+
+			g.registry = registry
+			g.ownsRegistry = true
+		}
 	}
 
-	if err := auth.Open(g.ctx); err != nil {
-		return err
+	go g.monitorSeeding()
+	go g.monitorBandwidth()
+	go g.monitorRates()
+	go g.monitorTrackers()
+
+	if g.registry != nil {
+		g.log.Debug().
+			Str("advertiseURL", g.cluster.AdvertiseURL).
+			Str("mode", g.cluster.Mode).
+			Msg("Joined cluster")
+
+		go g.monitorRegistry()
 	}
 
-	mux := http.NewServeMux()
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
 
-	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
-		u, p, ok := r.BasicAuth()
-		if err := auth.Validate(u, p); !ok || err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+	var err error
+	g.limiter, err = newLimiter(g.limits)
+	if err != nil {
+		return nil, err
+	}
 
-			panic(fmt.Errorf("%v", http.StatusUnauthorized))
+	if g.auditLog != nil {
+		if err := g.auditLog.Open(); err != nil {
+			return nil, err
 		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/info", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
 
 		magnetLink := r.URL.Query().Get("magnet")
 		if magnetLink == "" {
@@ -124,45 +390,31 @@ func (g *Gateway) Open() error {
 			panic(ErrEmptyMagnetLink)
 		}
 
-		log.Debug().
+		g.log.Debug().
 			Str("magnet", magnetLink).
 			Msg("Getting info")
 
-		t, err := c.AddMagnet(magnetLink)
-		if err != nil {
-			panic(err)
-		}
-		<-t.GotInfo()
+		t := g.getTorrent(w, r, principal, magnetLink)
 
-		info := v1.Info{
-			Files: []v1.File{},
-		}
-		info.Name = t.Info().BestName()
-		info.InfoHash = t.InfoHash().HexString()
-		info.CreationDate = t.Metainfo().CreationDate
+		info := getInfo(t)
 
 		foundDescription := false
-		for _, f := range t.Files() {
-			log.Debug().
+		for i, f := range t.Files() {
+			g.log.Debug().
 				Str("magnet", magnetLink).
 				Str("path", f.Path()).
 				Msg("Got info")
 
-			info.Files = append(info.Files, v1.File{
-				Path:   f.Path(),
-				Length: f.Length(),
-			})
-
-			if path.Ext(f.Path()) == ".txt" {
+			if path.Ext(f.Path()) == ".txt" && g.isSelected(t.InfoHash(), i) {
 				if foundDescription {
 					continue
 				}
 
-				r := f.NewReader()
-				defer r.Close()
+				fr := g.newFileReader(r.Context(), f)
+				defer fr.Close()
 
 				var description bytes.Buffer
-				if _, err := io.Copy(&description, r); err != nil {
+				if _, err := io.Copy(&description, fr); err != nil {
 					panic(err)
 				}
 
@@ -176,26 +428,24 @@ func (g *Gateway) Open() error {
 		if err := enc.Encode(info); err != nil {
 			panic(err)
 		}
-	})
+	}))
 
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		u, p, ok := r.BasicAuth()
-		if err := auth.Validate(u, p); !ok || err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+	mux.HandleFunc("/metrics", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanGetMetrics() {
+			w.WriteHeader(http.StatusForbidden)
 
-			panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			panic(ErrForbidden)
 		}
 
-		log.Debug().
+		g.log.Debug().
 			Msg("Getting metrics")
 
 		metrics := []v1.TorrentMetrics{}
 		for _, t := range g.torrentClient.Torrents() {
-			mi := t.Metainfo()
-
-			info, err := mi.UnmarshalInfo()
+			magnetLink, err := getMagnet(t.Metainfo())
 			if err != nil {
-				log.Error().
+				g.log.Error().
 					Err(err).
 					Msg("Could not unmarshal metainfo")
 
@@ -203,19 +453,40 @@ func (g *Gateway) Open() error {
 			}
 
 			fileMetrics := []v1.FileMetrics{}
-			for _, f := range t.Files() {
-				fileMetrics = append(fileMetrics, v1.FileMetrics{
-					Path:      f.Path(),
-					Length:    f.Length(),
-					Completed: f.BytesCompleted(),
-				})
+			for i, f := range t.Files() {
+				fileMetrics = append(fileMetrics, g.getFileMetrics(t, f, i))
+			}
+
+			infoHash, infoHashV2 := getInfoHashes(t)
+
+			downloadLimit, uploadLimit := g.getTorrentBandwidth(t.InfoHash())
+			downloadedFromPeers, downloadedFromWebSeeds, webSeeds := g.getSourceMetrics(t.InfoHash())
+			downloadRate, uploadRate := g.getRates(t.InfoHash(), -1)
+
+			eta := int64(-1)
+			if t.Info() != nil {
+				eta = getETA(t.Length()-t.BytesCompleted(), downloadRate)
 			}
 
 			torrentMetrics := v1.TorrentMetrics{
-				Magnet:   mi.Magnet(nil, &info).String(),
-				InfoHash: mi.HashInfoBytes().HexString(),
-				Peers:    len(t.PeerConns()),
-				Files:    fileMetrics,
+				Magnet:                 magnetLink,
+				InfoHash:               infoHash,
+				InfoHashV2:             infoHashV2,
+				Peers:                  len(t.PeerConns()),
+				Paused:                 g.isPaused(t.InfoHash()),
+				Uploaded:               g.getUploaded(t),
+				Ratio:                  g.getRatio(t),
+				Seeding:                g.isSeeding(t),
+				DownloadLimit:          downloadLimit,
+				UploadLimit:            uploadLimit,
+				DownloadedFromPeers:    downloadedFromPeers,
+				DownloadedFromWebSeeds: downloadedFromWebSeeds,
+				WebSeeds:               webSeeds,
+				DownloadRate:           downloadRate,
+				UploadRate:             uploadRate,
+				ETA:                    eta,
+				Streams:                g.getTorrentStreamMetrics(t.InfoHash()),
+				Files:                  fileMetrics,
 			}
 
 			metrics = append(metrics, torrentMetrics)
@@ -225,37 +496,187 @@ func (g *Gateway) Open() error {
 		if err := enc.Encode(metrics); err != nil {
 			panic(err)
 		}
-	})
+	}))
 
-	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			err := recover()
+	mux.HandleFunc("/events", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanGetMetrics() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		g.log.Debug().
+			Msg("Following progress events")
 
-			switch err {
-			case http.StatusUnauthorized:
-				fallthrough
+		events := make(chan v1.ProgressEvent, progressEventBuffer)
+		unsubscribe := g.progress.subscribe(func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics) {
+			select {
+			case events <- v1.ProgressEvent{
+				Torrent: torrentMetrics,
+				File:    fileMetrics,
+			}:
 			default:
-				w.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			panic(err)
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-g.ctx.Done():
+				return
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					panic(err)
+				}
 
-				e, ok := err.(error)
-				if ok {
-					log.Debug().
-						Err(e).
-						Msg("Closed connection for client")
-				} else {
-					log.Debug().Msg("Closed connection for client")
+				if err := rc.Flush(); err != nil {
+					panic(err)
 				}
 			}
-		}()
+		}
+	}))
 
-		u, p, ok := r.BasicAuth()
-		if err := auth.Validate(u, p); !ok || err != nil {
-			w.Header().Set("WWW-Authenticate", `Basic realm="hTorrent"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	mux.HandleFunc("/metrics/limits", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanGetMetrics() {
+			w.WriteHeader(http.StatusForbidden)
 
-			panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			panic(ErrForbidden)
+		}
+
+		g.log.Debug().
+			Msg("Getting limit metrics")
+
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(g.limiter.getMetrics()); err != nil {
+			panic(err)
+		}
+	}))
+
+	mux.HandleFunc("/peers", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanGetMetrics() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		magnetLink := r.URL.Query().Get("magnet")
+		if magnetLink == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(ErrEmptyMagnetLink)
+		}
+
+		m, err := ParseMagnet(magnetLink)
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+
+		t, ok := g.torrentClient.Torrent(m.InfoHash)
+		if !ok {
+			g.forwardToOwner(w, r, m.InfoHash)
+
+			w.WriteHeader(http.StatusNotFound)
+
+			panic(ErrUnknownTorrent)
+		}
+
+		g.log.Debug().
+			Str("magnet", magnetLink).
+			Msg("Getting peers")
+
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(g.getSwarm(t)); err != nil {
+			panic(err)
+		}
+	}))
+
+	mux.HandleFunc("/streams", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanGetMetrics() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		g.log.Debug().
+			Msg("Getting streams")
+
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(g.getStreamMetrics()); err != nil {
+			panic(err)
+		}
+	}))
+
+	mux.HandleFunc("/streams/{id}", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+		if !principal.Role.CanManageTorrents() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		id := r.PathValue("id")
+		if id == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(ErrEmptyStreamID)
+		}
+
+		g.log.Debug().
+			Str("id", id).
+			Str("principal", principal.Name).
+			Msg("Canceling stream")
+
+		stream, ok := g.cancelStream(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			panic(ErrUnknownStream)
 		}
 
+		g.audit(r, principal, v1.AuditEvent{
+			Action:   AuditActionCancel,
+			InfoHash: stream.infoHash.HexString(),
+			Path:     stream.path,
+		})
+	}))
+
+	mux.HandleFunc("/stream", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+
 		magnetLink := r.URL.Query().Get("magnet")
 		if magnetLink == "" {
 			w.WriteHeader(http.StatusUnprocessableEntity)
@@ -264,128 +685,985 @@ func (g *Gateway) Open() error {
 		}
 
 		path := r.URL.Query().Get("path")
-		if path == "" {
+		rawIndex := r.URL.Query().Get("index")
+		if path == "" && rawIndex == "" {
 			w.WriteHeader(http.StatusUnprocessableEntity)
 
 			panic(ErrEmptyPath)
 		}
 
-		log.Debug().
+		index := -1
+		if rawIndex != "" {
+			var err error
+			index, err = parseFileIndex(rawIndex)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+
+				panic(err)
+			}
+		}
+
+		g.log.Debug().
 			Str("magnet", magnetLink).
 			Str("path", path).
+			Str("index", rawIndex).
 			Msg("Getting stream")
 
-		t, err := c.AddMagnet(magnetLink)
+		t := g.getTorrent(w, r, principal, magnetLink)
+
+		f, index := findFile(t, index, path)
+		if f == nil {
+			w.WriteHeader(http.StatusNotFound)
+
+			panic(ErrCouldNotFindPath)
+		}
+
+		if !g.isSelected(t.InfoHash(), index) {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(fmt.Errorf("%w: %v", ErrFileNotSelected, index))
+		}
+
+		id, err := newStreamID()
 		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+
 			panic(err)
 		}
-		<-t.GotInfo()
 
-		found := false
-		for _, l := range t.Files() {
-			f := l
+		egressLimiter, release, ok := g.limiter.acquireStream(g.limiter.getKey(r, principal))
+		if !ok {
+			setRetryAfter(w, streamRetryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
 
-			if f.Path() != path {
-				continue
-			}
+			panic(ErrTooManyStreams)
+		}
 
-			found = true
-
-			go func() {
-				tick := time.NewTicker(time.Millisecond * 100)
-				defer tick.Stop()
-
-				lastCompleted := int64(0)
-				for range tick.C {
-					if completed, length := f.BytesCompleted(), f.Length(); completed < length {
-						if completed != lastCompleted {
-							g.onDownloadProgress(
-								v1.TorrentMetrics{
-									Magnet: magnetLink,
-									Peers:  len(f.Torrent().PeerConns()),
-									Files:  []v1.FileMetrics{},
-								},
-								v1.FileMetrics{
-									Path:      f.Path(),
-									Length:    length,
-									Completed: completed,
-								},
-							)
-						}
-
-						lastCompleted = completed
-					} else {
-						return
-					}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		rc := http.NewResponseController(w)
+		stream := &activeStream{
+			id:         id,
+			principal:  principal.Name,
+			remoteAddr: r.RemoteAddr,
+			infoHash:   t.InfoHash(),
+			index:      index,
+			path:       f.Path(),
+			length:     f.Length(),
+			started:    time.Now(),
+			cancel: func() {
+				cancel()
+
+				if err := rc.SetWriteDeadline(time.Now()); err != nil {
+					g.log.Debug().
+						Err(err).
+						Str("id", id).
+						Msg("Could not interrupt stream")
 				}
-			}()
+			},
+		}
+		removeStream := g.addStream(stream)
+		defer removeStream()
 
-			log.Debug().
-				Str("magnet", magnetLink).
-				Str("path", path).
-				Msg("Got stream")
+		var rw http.ResponseWriter = &streamResponseWriter{
+			ResponseWriter: w,
 
-			http.ServeContent(w, r, f.DisplayPath(), time.Unix(f.Torrent().Metainfo().CreationDate, 0), f.NewReader())
+			g:      g,
+			stream: stream,
 		}
+		if egressLimiter != nil {
+			rw = &rateLimitedResponseWriter{
+				ResponseWriter: rw,
 
-		if !found {
-			w.WriteHeader(http.StatusNotFound)
+				limiter: egressLimiter,
+				ctx:     ctx,
+			}
+		}
 
-			panic(ErrCouldNotFindPath)
+		start := int64(0)
+		if cw, ok := w.(*responseWriter); ok {
+			start = cw.written
 		}
-	})
+		defer func() {
+			written := int64(0)
+			if cw, ok := w.(*responseWriter); ok {
+				written = cw.written - start
+			}
 
-	g.srv = &http.Server{Addr: g.laddr}
-	g.srv.Handler = mux
+			release(written)
 
-	log.Debug().
-		Str("address", g.laddr).
-		Msg("Listening")
+			g.audit(r, principal, v1.AuditEvent{
+				Action:   AuditActionStream,
+				Magnet:   magnetLink,
+				InfoHash: t.InfoHash().HexString(),
+				Path:     f.Path(),
+				Bytes:    written,
+				Duration: time.Since(stream.started).Milliseconds(),
+			})
+		}()
 
-	go func() {
-		if err := g.srv.ListenAndServe(); err != nil {
-			if err == http.ErrServerClosed {
-				close(g.errs)
+		untrack := g.progress.track(magnetLink, f, index)
+		defer untrack()
 
-				return
-			}
+		g.log.Debug().
+			Str("magnet", magnetLink).
+			Str("path", f.Path()).
+			Msg("Got stream")
 
-			g.errs <- err
+		fr := &streamReader{
+			ReadSeekCloser: g.newFileReader(ctx, f),
 
-			return
+			ctx:    ctx,
+			g:      g,
+			stream: stream,
 		}
-	}()
+		defer fr.Close()
 
-	return nil
-}
+		http.ServeContent(rw, r, f.DisplayPath(), time.Unix(f.Torrent().Metainfo().CreationDate, 0), fr)
+	}))
 
-func (g *Gateway) Close() error {
-	log.Trace().Msg("Closing gateway")
+	mux.HandleFunc("/torrents", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
 
-	if err := g.srv.Shutdown(g.ctx); err != nil {
-		if err != context.Canceled {
-			return err
+		if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		if (r.Method == http.MethodDelete && !principal.Role.CanRemoveTorrents()) || (r.Method == http.MethodPost && !principal.Role.CanManageTorrents()) {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
 		}
-	}
 
-	errs := g.torrentClient.Close()
-	for _, err := range errs {
+		magnetLink := r.URL.Query().Get("magnet")
+		if magnetLink == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(ErrEmptyMagnetLink)
+		}
+
+		m, err := ParseMagnet(magnetLink)
 		if err != nil {
-			if err != context.Canceled {
-				return err
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+
+		t, ok := g.torrentClient.Torrent(m.InfoHash)
+		if !ok {
+			g.forwardToOwner(w, r, m.InfoHash)
+
+			w.WriteHeader(http.StatusNotFound)
+
+			panic(ErrUnknownTorrent)
+		}
+
+		if r.Method == http.MethodDelete {
+			g.log.Debug().
+				Str("magnet", magnetLink).
+				Str("principal", principal.Name).
+				Msg("Removing torrent")
+
+			t.Drop()
+
+			if err := g.forgetTorrent(t.InfoHash()); err != nil {
+				panic(err)
+			}
+
+			if err := g.removeUpload(t.InfoHash()); err != nil {
+				g.log.Error().
+					Err(err).
+					Str("magnet", magnetLink).
+					Msg("Could not remove upload")
 			}
+
+			if err := g.unregisterTorrent(t); err != nil {
+				g.log.Error().
+					Err(err).
+					Str("magnet", magnetLink).
+					Msg("Could not unregister torrent")
+			}
+
+			g.audit(r, principal, v1.AuditEvent{
+				Action:   AuditActionRemove,
+				Magnet:   magnetLink,
+				InfoHash: m.InfoHash.HexString(),
+			})
+
+			return
 		}
-	}
 
-	return nil
-}
+		rawPaused := r.URL.Query().Get("paused")
+		rawPriority := r.URL.Query().Get("priority")
+		rawSeed := r.URL.Query().Get("seed")
+		rawSeedRatio := r.URL.Query().Get("seedRatio")
+		rawSeedTime := r.URL.Query().Get("seedTime")
+		rawDownloadRate := r.URL.Query().Get("downloadRate")
+		rawUploadRate := r.URL.Query().Get("uploadRate")
+		rawWebSeeds := r.URL.Query()["webSeed"]
+		if rawPaused == "" && rawPriority == "" && rawSeed == "" && rawSeedRatio == "" && rawSeedTime == "" && rawDownloadRate == "" && rawUploadRate == "" && len(rawWebSeeds) == 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
 
-func (g *Gateway) Wait() error {
-	for err := range g.errs {
-		if err != nil {
-			return err
+			panic(ErrEmptyUpdate)
 		}
-	}
+
+		g.log.Debug().
+			Str("magnet", magnetLink).
+			Str("principal", principal.Name).
+			Str("paused", rawPaused).
+			Str("priority", rawPriority).
+			Str("seed", rawSeed).
+			Str("seedRatio", rawSeedRatio).
+			Str("seedTime", rawSeedTime).
+			Str("downloadRate", rawDownloadRate).
+			Str("uploadRate", rawUploadRate).
+			Strs("webSeeds", rawWebSeeds).
+			Msg("Updating torrent")
+
+		if rawPaused != "" {
+			paused, err := strconv.ParseBool(rawPaused)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+
+				panic(err)
+			}
+
+			if err := g.setPaused(t, paused); err != nil {
+				panic(err)
+			}
+		}
+
+		if rawPriority != "" {
+			priority, err := ParsePriority(rawPriority)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+
+				panic(err)
+			}
+
+			path := r.URL.Query().Get("path")
+			rawIndex := r.URL.Query().Get("index")
+			if path == "" && rawIndex == "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+
+				panic(ErrEmptyPath)
+			}
+
+			index := -1
+			if rawIndex != "" {
+				index, err = parseFileIndex(rawIndex)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+			}
+
+			<-t.GotInfo()
+
+			f, index := findFile(t, index, path)
+			if f == nil {
+				w.WriteHeader(http.StatusNotFound)
+
+				panic(ErrCouldNotFindPath)
+			}
+
+			if err := g.setPriority(t, index, priority); err != nil {
+				panic(err)
+			}
+
+			if priority != torrent.PiecePriorityNone {
+				if err := g.selectFile(t, index); err != nil {
+					panic(err)
+				}
+			}
+		}
+
+		if rawSeed != "" || rawSeedRatio != "" || rawSeedTime != "" {
+			seeding := g.getSeedingPolicy(t.InfoHash())
+
+			if rawSeed != "" {
+				seed, err := strconv.ParseBool(rawSeed)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+
+				seeding.Disabled = !seed
+			}
+
+			if rawSeedRatio != "" {
+				seeding.Ratio, err = strconv.ParseFloat(rawSeedRatio, 64)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+			}
+
+			if rawSeedTime != "" {
+				seeding.Duration, err = time.ParseDuration(rawSeedTime)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+			}
+
+			if err := g.setSeeding(t, seeding); err != nil {
+				panic(err)
+			}
+		}
+
+		if rawDownloadRate != "" || rawUploadRate != "" {
+			downloadRate, uploadRate := g.getTorrentBandwidth(t.InfoHash())
+
+			if rawDownloadRate != "" {
+				downloadRate, err = strconv.Atoi(rawDownloadRate)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+			}
+
+			if rawUploadRate != "" {
+				uploadRate, err = strconv.Atoi(rawUploadRate)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+			}
+
+			if err := g.setTorrentBandwidth(t, downloadRate, uploadRate); err != nil {
+				panic(err)
+			}
+		}
+
+		if len(rawWebSeeds) > 0 {
+			webSeeds := []string{}
+			for _, rawWebSeed := range rawWebSeeds {
+				webSeed, err := ParseWebSeed(rawWebSeed)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+
+				webSeeds = append(webSeeds, webSeed)
+			}
+
+			if err := g.addWebSeeds(t, webSeeds); err != nil {
+				panic(err)
+			}
+		}
+	}))
+
+	mux.HandleFunc("/create", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		if !principal.Role.CanManageTorrents() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		rawPath := r.URL.Query().Get("path")
+		if rawPath == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(ErrEmptyPath)
+		}
+
+		root, err := g.getSeedPath(rawPath)
+		if err != nil {
+			if errors.Is(err, ErrMissingSeedDirectory) {
+				w.WriteHeader(http.StatusNotImplemented)
+			} else {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			}
+
+			panic(err)
+		}
+
+		opts := getCreateOptions(w, r)
+
+		g.log.Debug().
+			Str("path", rawPath).
+			Str("principal", principal.Name).
+			Str("version", opts.Version).
+			Int64("pieceLength", opts.PieceLength).
+			Msg("Creating torrent")
+
+		mi, err := CreateTorrent(root, opts)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				w.WriteHeader(http.StatusNotFound)
+			} else if errors.Is(err, ErrUnknownTorrentVersion) || errors.Is(err, ErrInvalidPieceLength) || errors.Is(err, ErrNoFilesToCreateFrom) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			panic(err)
+		}
+
+		g.checkCreatedTorrent(w, r, principal, mi)
+		g.publishTorrent(w, r, principal, AuditActionCreate, mi, root)
+	}))
+
+	mux.HandleFunc("/upload", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		if !principal.Role.CanManageTorrents() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		name, err := ParseUploadName(r.URL.Query().Get("name"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+
+			panic(err)
+		}
+
+		opts := getCreateOptions(w, r)
+
+		g.reloadLock.RLock()
+		policy := g.policy
+		g.reloadLock.RUnlock()
+
+		body := r.Body
+		if policy.MaxSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, policy.MaxSize)
+		}
+
+		g.log.Debug().
+			Str("name", name).
+			Str("principal", principal.Name).
+			Str("version", opts.Version).
+			Int64("pieceLength", opts.PieceLength).
+			Int64("length", r.ContentLength).
+			Msg("Uploading torrent")
+
+		mi, upload, err := g.uploadTorrent(name, r.ContentLength, body, opts)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			} else if errors.Is(err, ErrUnknownTorrentVersion) || errors.Is(err, ErrInvalidPieceLength) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			panic(err)
+		}
+
+		defer func() {
+			if err := g.discardUpload(upload); err != nil {
+				g.log.Error().
+					Err(err).
+					Str("name", name).
+					Msg("Could not remove upload")
+			}
+		}()
+
+		g.checkCreatedTorrent(w, r, principal, mi)
+
+		root, err := g.storeUpload(mi, name, upload)
+		if err != nil {
+			panic(err)
+		}
+
+		g.publishTorrent(w, r, principal, AuditActionUpload, mi, root)
+	}))
+
+	mux.HandleFunc("/bandwidth", g.handle(func(w http.ResponseWriter, r *http.Request) {
+		principal := g.authenticate(w, r)
+
+		switch r.Method {
+		case http.MethodGet:
+			if !principal.Role.CanGetMetrics() {
+				w.WriteHeader(http.StatusForbidden)
+
+				panic(ErrForbidden)
+			}
+
+		case http.MethodPost:
+			if !principal.Role.CanManageTorrents() {
+				w.WriteHeader(http.StatusForbidden)
+
+				panic(ErrForbidden)
+			}
+
+			rawDownloadRate := r.URL.Query().Get("downloadRate")
+			rawUploadRate := r.URL.Query().Get("uploadRate")
+			if rawDownloadRate == "" && rawUploadRate == "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+
+				panic(ErrEmptyUpdate)
+			}
+
+			g.log.Debug().
+				Str("principal", principal.Name).
+				Str("downloadRate", rawDownloadRate).
+				Str("uploadRate", rawUploadRate).
+				Msg("Updating bandwidth")
+
+			var downloadRate, uploadRate *int
+			if rawDownloadRate != "" {
+				d, err := strconv.Atoi(rawDownloadRate)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+
+				downloadRate = &d
+			}
+
+			if rawUploadRate != "" {
+				u, err := strconv.Atoi(rawUploadRate)
+				if err != nil {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+
+					panic(err)
+				}
+
+				uploadRate = &u
+			}
+
+			if !g.canLimitBandwidth() {
+				w.WriteHeader(http.StatusNotImplemented)
+
+				panic(ErrUnsupportedWithTorrentClient)
+			}
+
+			g.setBandwidth(downloadRate, uploadRate)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			panic(fmt.Errorf("%v", http.StatusMethodNotAllowed))
+		}
+
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(g.getBandwidth()); err != nil {
+			panic(err)
+		}
+	}))
+
+	var handler http.Handler = mux
+	if basePath := strings.TrimSuffix(g.basePath, "/"); basePath != "" {
+		handler = http.StripPrefix(basePath, handler)
+	}
+
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		handler = g.middlewares[i](handler)
+	}
+
+	return handler, nil
+}
+
+func (g *Gateway) Open() error {
+	handler, err := g.OpenHandler()
+	if err != nil {
+		return err
+	}
+
+	g.srv = &http.Server{Addr: g.laddr}
+	g.srv.Handler = handler
+
+	if g.tls.Enabled() {
+		g.srv.TLSConfig, err = g.tls.getConfig(g.log)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.log.Debug().
+		Str("address", g.laddr).
+		Bool("tls", g.tls.Enabled()).
+		Msg("Listening")
+
+	go func() {
+		listenAndServe := g.srv.ListenAndServe
+		if g.tls.Enabled() {
+			listenAndServe = func() error {
+				return g.srv.ListenAndServeTLS("", "")
+			}
+		}
+
+		if err := listenAndServe(); err != nil {
+			if err == http.ErrServerClosed {
+				close(g.errs)
+
+				return
+			}
+
+			g.errs <- err
+
+			return
+		}
+	}()
+
+	return nil
+}
+
+func (g *Gateway) Reload() error {
+	g.log.Trace().Msg("Reloading gateway")
+
+	roles, err := LoadRoles(g.rolesFile)
+	if err != nil {
+		return err
+	}
+
+	policy, err := LoadPolicy(g.policyFile)
+	if err != nil {
+		return err
+	}
+
+	var auth Authenticator
+	if g.authenticator != nil {
+		auth = g.authenticator
+	} else if strings.TrimSpace(g.oidcIssuer) == "" && strings.TrimSpace(g.oidcClientID) == "" {
+		var users authn.Authn
+		if strings.TrimSpace(g.usersFile) == "" {
+			users = basic.NewAuthn(g.apiUsername, g.apiPassword)
+		} else {
+			u, err := LoadUsers(g.usersFile)
+			if err != nil {
+				return err
+			}
+
+			users = NewUsersAuthn(u)
+		}
+
+		auth = NewBasicAuthenticator(users, roles, g.defaultRole)
+	} else {
+		auth = NewOIDCAuthenticator(g.oidcIssuer, g.oidcClientID, g.rolesClaim, roles, g.defaultRole)
+	}
+
+	if err := auth.Open(g.ctx); err != nil {
+		return err
+	}
+
+	g.reloadLock.Lock()
+	defer g.reloadLock.Unlock()
+
+	g.auth = auth
+	g.challenge = auth.Challenge()
+	g.roles = roles
+	g.policy = policy
+
+	return nil
+}
+
+func (g *Gateway) authenticate(w http.ResponseWriter, r *http.Request) Principal {
+	g.reloadLock.RLock()
+	auth, challenge, roles := g.auth, g.challenge, g.roles
+	g.reloadLock.RUnlock()
+
+	principal, ok := getClientCertificatePrincipal(r, roles, g.defaultRole)
+	if !ok {
+		ipKey := g.limiter.getIPKey(r)
+		if delay, ok := g.limiter.checkRequest(ipKey); !ok {
+			setRetryAfter(w, delay)
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			panic(ErrTooManyRequests)
+		}
+
+		unauthorized := func() {
+			g.limiter.allowRequest(ipKey)
+
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+			panic(fmt.Errorf("%v", http.StatusUnauthorized))
+		}
+
+		u, p, ok := getCredentials(r)
+		if !ok {
+			unauthorized()
+		}
+
+		var err error
+		principal, err = auth.Authenticate(u, p)
+		if err != nil {
+			unauthorized()
+		}
+	}
+
+	if delay, ok := g.limiter.allowRequest(g.limiter.getKey(r, principal)); !ok {
+		setRetryAfter(w, delay)
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		panic(ErrTooManyRequests)
+	}
+
+	return principal
+}
+
+func (g *Gateway) getTorrent(w http.ResponseWriter, r *http.Request, principal Principal, magnetLink string) *torrent.Torrent {
+	mv2, err := metainfo.ParseMagnetV2Uri(magnetLink)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		panic(err)
+	}
+
+	m, err := getShortMagnet(mv2)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		panic(err)
+	}
+
+	selection, err := getSelectOnly(magnetLink)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		panic(err)
+	}
+
+	g.reloadLock.RLock()
+	policy := g.policy
+	g.reloadLock.RUnlock()
+
+	if err := policy.CheckMagnet(mv2); err != nil {
+		g.rejectTorrent(w, r, principal, magnetLink, m.InfoHash.HexString(), err)
+	}
+
+	t, ok := g.torrentClient.Torrent(m.InfoHash)
+	added := !ok
+	if added {
+		g.forwardToOwner(w, r, m.InfoHash)
+
+		if !principal.Role.CanAddTorrents() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		g.log.Debug().
+			Str("magnet", magnetLink).
+			Str("principal", principal.Name).
+			Msg("Adding torrent")
+
+		t, err = g.addTorrentFromRegistry(magnetLink, m.InfoHash)
+		if err != nil {
+			panic(err)
+		}
+
+		g.network.addTrackers(t)
+
+		g.audit(r, principal, v1.AuditEvent{
+			Action:   AuditActionAdd,
+			Magnet:   magnetLink,
+			InfoHash: m.InfoHash.HexString(),
+		})
+
+		if err := g.persistTorrent(t, magnetLink); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not persist torrent")
+		}
+	}
+	<-t.GotInfo()
+
+	t, err = g.mergeTorrent(t)
+	if err != nil {
+		panic(err)
+	}
+
+	err = policy.CheckInfoHashes(getInfoHashes(t))
+	if err == nil {
+		err = policy.CheckInfo(t.Info())
+	}
+
+	if err != nil {
+		t.Drop()
+
+		if err := g.forgetTorrent(t.InfoHash()); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not forget torrent")
+		}
+
+		g.rejectTorrent(w, r, principal, magnetLink, m.InfoHash.HexString(), err)
+	}
+
+	if added {
+		if err := g.rekeyTorrent(m.InfoHash, t); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not rekey torrent")
+		}
+
+		if err := g.persistTorrent(t, magnetLink); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not persist torrent")
+		}
+
+		if err := g.selectFiles(t, selection); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not select files")
+		}
+
+		if err := g.registerTorrent(t); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("magnet", magnetLink).
+				Msg("Could not register torrent")
+		}
+	} else if indexes := g.getUnselectedFiles(t, selection); len(indexes) > 0 {
+		if !principal.Role.CanAddTorrents() {
+			w.WriteHeader(http.StatusForbidden)
+
+			panic(ErrForbidden)
+		}
+
+		g.log.Debug().
+			Str("magnet", magnetLink).
+			Ints("indexes", indexes).
+			Msg("Adding files to selection")
+
+		if err := g.mergeSelection(t, indexes); err != nil {
+			panic(err)
+		}
+	}
+
+	return t
+}
+
+func (g *Gateway) rejectTorrent(w http.ResponseWriter, r *http.Request, principal Principal, magnetLink string, infoHash string, err error) {
+	g.log.Warn().
+		Err(err).
+		Str("magnet", magnetLink).
+		Str("principal", principal.Name).
+		Msg("Rejected torrent")
+
+	g.audit(r, principal, v1.AuditEvent{
+		Action:   AuditActionReject,
+		Magnet:   magnetLink,
+		InfoHash: infoHash,
+		Error:    err.Error(),
+	})
+
+	w.WriteHeader(http.StatusForbidden)
+
+	panic(err)
+}
+
+func (g *Gateway) audit(r *http.Request, principal Principal, event v1.AuditEvent) {
+	if g.auditLog == nil {
+		return
+	}
+
+	event.Time = time.Now().Unix()
+	event.Principal = principal.Name
+	event.RemoteAddr = r.RemoteAddr
+
+	if err := g.auditLog.Write(event); err != nil {
+		g.log.Error().
+			Err(err).
+			Msg("Could not write to audit log")
+	}
+}
+
+func (g *Gateway) Close() error {
+	g.log.Trace().Msg("Closing gateway")
+
+	defer close(g.done)
+
+	if g.srv == nil {
+		close(g.errs)
+	} else if err := g.srv.Shutdown(g.ctx); err != nil {
+		if err != context.Canceled {
+			return err
+		}
+	}
+
+	g.checkAllSeeding()
+	close(g.closed)
+
+	if g.registry != nil {
+		g.releaseAllTorrents()
+
+		if g.ownsRegistry {
+			if err := g.registry.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if g.ownsTorrentClient {
+		errs := g.torrentClient.Close()
+		for _, err := range errs {
+			if err != nil {
+				if err != context.Canceled {
+					return err
+				}
+			}
+		}
+	}
+
+	if g.storageCloser != nil {
+		if err := g.storageCloser.Close(); err != nil {
+			return err
+		}
+	}
+
+	if g.session != nil {
+		if err := g.session.close(); err != nil {
+			return err
+		}
+	}
+
+	if g.auditLog != nil {
+		if err := g.auditLog.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) Wait() error {
+	for err := range g.errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	<-g.done
 
 	return nil
 }
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+)
+
+type responseWriter struct {
+	http.ResponseWriter
+
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (g *Gateway) handle(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			if rw.status == 0 {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+
+			e, ok := err.(error)
+			if ok {
+				g.log.Debug().
+					Err(e).
+					Msg("Closed connection for client")
+			} else {
+				g.log.Debug().Msg("Closed connection for client")
+			}
+		}()
+
+		handler(rw, r)
+	}
+}
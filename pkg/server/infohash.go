@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+var (
+	ErrMissingInfoHash = errors.New("could not find a btih or btmh infohash in magnet link")
+)
+
+func ParseMagnet(magnetLink string) (metainfo.Magnet, error) {
+	m, err := metainfo.ParseMagnetV2Uri(magnetLink)
+	if err != nil {
+		return metainfo.Magnet{}, err
+	}
+
+	return getShortMagnet(m)
+}
+
+func getShortMagnet(m metainfo.MagnetV2) (metainfo.Magnet, error) {
+	infoHash := m.InfoHash.UnwrapOrZeroValue()
+	if !m.InfoHash.Ok {
+		if !m.V2InfoHash.Ok {
+			return metainfo.Magnet{}, ErrMissingInfoHash
+		}
+
+		infoHash = *m.V2InfoHash.Value.ToShort()
+	}
+
+	return metainfo.Magnet{
+		InfoHash:    infoHash,
+		Trackers:    m.Trackers,
+		DisplayName: m.DisplayName,
+		Params:      m.Params,
+	}, nil
+}
+
+func getInfoHashes(t *torrent.Torrent) (string, string) {
+	infoHash := t.InfoHash().HexString()
+
+	info := t.Info()
+	if info == nil {
+		return infoHash, ""
+	}
+
+	infoHashV2 := ""
+	if info.HasV2() {
+		v2 := infohash_v2.HashBytes(t.Metainfo().InfoBytes)
+		infoHashV2 = v2.HexString()
+	}
+
+	return infoHash, infoHashV2
+}
+
+func getShortInfoHashes(t *torrent.Torrent) []metainfo.Hash {
+	infoHashes := []metainfo.Hash{t.InfoHash()}
+
+	info := t.Info()
+	if info != nil && info.HasV1() && info.HasV2() {
+		v2 := infohash_v2.HashBytes(t.Metainfo().InfoBytes)
+		infoHashes = append(infoHashes, *v2.ToShort())
+	}
+
+	return infoHashes
+}
+
+func getMetainfoInfoHashes(mi *metainfo.MetaInfo) (string, string, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", "", err
+	}
+
+	infoHash, err := getShortInfoHash(mi)
+	if err != nil {
+		return "", "", err
+	}
+
+	infoHashV2 := ""
+	if info.HasV2() {
+		v2 := infohash_v2.HashBytes(mi.InfoBytes)
+		infoHashV2 = v2.HexString()
+	}
+
+	return infoHash.HexString(), infoHashV2, nil
+}
+
+func getShortInfoHash(mi *metainfo.MetaInfo) (metainfo.Hash, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return metainfo.Hash{}, err
+	}
+
+	if info.HasV1() {
+		return mi.HashInfoBytes(), nil
+	}
+
+	v2 := infohash_v2.HashBytes(mi.InfoBytes)
+
+	return *v2.ToShort(), nil
+}
+
+func (g *Gateway) addTorrentSpec(spec *torrent.TorrentSpec) (*torrent.Torrent, error) {
+	if spec.InfoHash.IsZero() && spec.InfoHashV2.Ok {
+		spec.InfoHash = *spec.InfoHashV2.Value.ToShort()
+		spec.InfoHashV2.SetNone()
+	}
+
+	if spec.InfoHashV2.Ok {
+		short := *spec.InfoHashV2.Value.ToShort()
+		spec.InfoHashV2.SetNone()
+
+		if _, ok := g.torrentClient.Torrent(spec.InfoHash); !ok {
+			if t, ok := g.torrentClient.Torrent(short); ok {
+				return t, t.MergeSpec(spec)
+			}
+		}
+	}
+
+	t, _, err := g.torrentClient.AddTorrentSpec(spec)
+
+	return t, err
+}
+
+func (g *Gateway) addMagnet(magnetLink string) (*torrent.Torrent, error) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetLink)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.addTorrentSpec(spec)
+}
+
+func (g *Gateway) addMetainfo(mi *metainfo.MetaInfo) (*torrent.Torrent, error) {
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.addTorrentSpec(spec)
+}
+
+func getMagnet(mi metainfo.MetaInfo) (string, error) {
+	m, err := mi.MagnetV2()
+	if err != nil {
+		return "", err
+	}
+
+	return m.String(), nil
+}
+
+func getPiecesRoot(f *torrent.File) string {
+	piecesRoot := f.FileInfo().PiecesRoot
+	if !piecesRoot.Ok {
+		return ""
+	}
+
+	return hex.EncodeToString(piecesRoot.Value[:])
+}
+
+func getInfo(t *torrent.Torrent) v1.Info {
+	infoHash, infoHashV2 := getInfoHashes(t)
+
+	info := v1.Info{
+		Name:         t.Info().BestName(),
+		InfoHash:     infoHash,
+		InfoHashV2:   infoHashV2,
+		CreationDate: t.Metainfo().CreationDate,
+		Files:        []v1.File{},
+	}
+
+	for i, f := range t.Files() {
+		info.Files = append(info.Files, v1.File{
+			Index:      i,
+			Path:       f.Path(),
+			Length:     f.Length(),
+			PiecesRoot: getPiecesRoot(f),
+		})
+	}
+
+	return info
+}
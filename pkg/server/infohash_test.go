@@ -0,0 +1,157 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func newTestHybridTorrent(t *testing.T) (*metainfo.MetaInfo, string, string) {
+	root := filepath.Join(t.TempDir(), "content")
+	writeTestFiles(t, root, map[string]int{
+		"a.bin": 3 * testPieceLength,
+		"b.bin": testPieceLength + 1,
+	})
+
+	mi, err := CreateTorrent(root, CreateOptions{
+		Version:     TorrentVersionHybrid,
+		PieceLength: testPieceLength,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mi.MagnetV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	btih := metainfo.Magnet{
+		InfoHash:    m.InfoHash.Value,
+		DisplayName: m.DisplayName,
+	}
+
+	m.InfoHash.SetNone()
+
+	return mi, btih.String(), m.String()
+}
+
+func newTestGateway(t *testing.T) *Gateway {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisablePEX = true
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return &Gateway{
+		torrentClient: client,
+	}
+}
+
+func TestAddHybridTorrentByV2ThenV1InfoHash(t *testing.T) {
+	mi, btih, btmh := newTestHybridTorrent(t)
+	g := newTestGateway(t)
+
+	a, err := g.addMagnet(btmh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SetInfoBytes(mi.InfoBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := g.mergeTorrent(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged != a {
+		t.Fatal("expected torrent without duplicates to be kept")
+	}
+
+	if got, want := a.InfoHash(), mi.HashInfoBytes(); got != want {
+		t.Fatalf("expected torrent to be keyed by v1 infohash %v once it has its info, got %v", want, got)
+	}
+
+	b, err := g.addMagnet(btih)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b != a {
+		t.Fatal("expected adding the torrent by v1 infohash to return the torrent added by v2 infohash")
+	}
+
+	if got := len(g.torrentClient.Torrents()); got != 1 {
+		t.Fatalf("expected one torrent, got %v", got)
+	}
+
+	if got := len(getShortInfoHashes(a)); got != 2 {
+		t.Fatalf("expected v1 and truncated v2 infohash to be registered, got %v infohashes", got)
+	}
+}
+
+func TestMergeHybridTorrentAddedByV1AndV2InfoHash(t *testing.T) {
+	mi, btih, btmh := newTestHybridTorrent(t)
+	g := newTestGateway(t)
+
+	a, err := g.addMagnet(btmh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := g.addMagnet(btih)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Fatal("expected torrents without info to be added separately")
+	}
+
+	for _, tor := range []*torrent.Torrent{a, b} {
+		if err := tor.SetInfoBytes(mi.InfoBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mergedA, err := g.mergeTorrent(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mergedB, err := g.mergeTorrent(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mergedA != mergedB {
+		t.Fatal("expected both torrents to be merged into the same torrent")
+	}
+
+	if got := len(g.torrentClient.Torrents()); got != 1 {
+		t.Fatalf("expected one torrent after merging, got %v", got)
+	}
+
+	for _, infoHash := range getShortInfoHashes(mergedA) {
+		if tor, ok := g.torrentClient.Torrent(infoHash); !ok || tor != mergedA {
+			t.Fatalf("expected merged torrent to be reachable by %v", infoHash)
+		}
+	}
+
+	if mergedA.Info() == nil {
+		t.Fatal("expected merged torrent to keep its info")
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+	"golang.org/x/time/rate"
+)
+
+const (
+	LimitByUser = "user"
+	LimitByIP   = "ip"
+
+	limiterIdleTimeout = time.Minute * 10
+	streamRetryAfter   = time.Second * 5
+)
+
+var (
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrTooManyStreams  = errors.New("too many concurrent streams")
+	ErrUnknownLimitBy  = errors.New("unknown limit key")
+)
+
+type Limits struct {
+	LimitBy      string
+	MaxStreams   int
+	RequestRate  float64
+	RequestBurst int
+	EgressRate   int
+}
+
+type clientLimiter struct {
+	streams  int
+	requests int64
+	rejected int64
+	egressed int64
+	lastSeen time.Time
+
+	requestLimiter *rate.Limiter
+	egressLimiter  *rate.Limiter
+}
+
+type limiter struct {
+	limits Limits
+
+	clientsLock sync.Mutex
+	clients     map[string]*clientLimiter
+	lastPrune   time.Time
+}
+
+func newLimiter(limits Limits) (*limiter, error) {
+	switch limits.LimitBy {
+	case "", LimitByUser, LimitByIP:
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownLimitBy, limits.LimitBy)
+	}
+
+	return &limiter{
+		limits:  limits,
+		clients: map[string]*clientLimiter{},
+	}, nil
+}
+
+func (l *limiter) getKey(r *http.Request, principal Principal) string {
+	if l.limits.LimitBy != LimitByIP {
+		return principal.Name
+	}
+
+	return l.getIPKey(r)
+}
+
+func (l *limiter) getIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (l *limiter) getClient(key string) *clientLimiter {
+	now := time.Now()
+	if now.Sub(l.lastPrune) > time.Minute {
+		for k, c := range l.clients {
+			if c.streams <= 0 && now.Sub(c.lastSeen) > limiterIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+
+		l.lastPrune = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientLimiter{}
+
+		if l.limits.RequestRate > 0 {
+			burst := l.limits.RequestBurst
+			if burst <= 0 {
+				burst = int(math.Max(1, math.Ceil(l.limits.RequestRate)))
+			}
+
+			c.requestLimiter = rate.NewLimiter(rate.Limit(l.limits.RequestRate), burst)
+		}
+
+		if l.limits.EgressRate > 0 {
+			c.egressLimiter = rate.NewLimiter(rate.Limit(l.limits.EgressRate), l.limits.EgressRate)
+		}
+
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	return c
+}
+
+func (l *limiter) allowRequest(key string) (time.Duration, bool) {
+	l.clientsLock.Lock()
+	defer l.clientsLock.Unlock()
+
+	c := l.getClient(key)
+	c.requests++
+
+	if c.requestLimiter == nil {
+		return 0, true
+	}
+
+	res := c.requestLimiter.Reserve()
+	if delay := res.Delay(); !res.OK() || delay > 0 {
+		res.Cancel()
+		c.rejected++
+
+		return delay, false
+	}
+
+	return 0, true
+}
+
+func (l *limiter) checkRequest(key string) (time.Duration, bool) {
+	l.clientsLock.Lock()
+	defer l.clientsLock.Unlock()
+
+	c := l.getClient(key)
+	if c.requestLimiter == nil {
+		return 0, true
+	}
+
+	tokens := c.requestLimiter.Tokens()
+	if tokens >= 1 {
+		return 0, true
+	}
+
+	c.requests++
+	c.rejected++
+
+	return time.Duration((1 - tokens) / float64(c.requestLimiter.Limit()) * float64(time.Second)), false
+}
+
+func (l *limiter) acquireStream(key string) (*rate.Limiter, func(written int64), bool) {
+	l.clientsLock.Lock()
+	defer l.clientsLock.Unlock()
+
+	c := l.getClient(key)
+	if l.limits.MaxStreams > 0 && c.streams >= l.limits.MaxStreams {
+		c.rejected++
+
+		return nil, nil, false
+	}
+
+	c.streams++
+
+	return c.egressLimiter, func(written int64) {
+		l.clientsLock.Lock()
+		defer l.clientsLock.Unlock()
+
+		c.streams--
+		c.egressed += written
+		c.lastSeen = time.Now()
+	}, true
+}
+
+func (l *limiter) getMetrics() []v1.LimitMetrics {
+	l.clientsLock.Lock()
+	defer l.clientsLock.Unlock()
+
+	metrics := []v1.LimitMetrics{}
+	for key, c := range l.clients {
+		metrics = append(metrics, v1.LimitMetrics{
+			Key:        key,
+			Streams:    c.streams,
+			MaxStreams: l.limits.MaxStreams,
+			Requests:   c.requests,
+			Rejected:   c.rejected,
+			Egressed:   c.egressed,
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Key < metrics[j].Key
+	})
+
+	return metrics
+}
+
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(delay.Seconds())))))
+}
+
+type rateLimitedResponseWriter struct {
+	http.ResponseWriter
+
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (w *rateLimitedResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := len(p)
+		if burst := w.limiter.Burst(); chunk > burst {
+			chunk = burst
+		}
+
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return written, err
+		}
+
+		n, err := w.ResponseWriter.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[chunk:]
+	}
+
+	return written, nil
+}
+
+func (w *rateLimitedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
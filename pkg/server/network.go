@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	EncryptionNone    = "none"
+	EncryptionAllow   = "allow"
+	EncryptionPrefer  = "prefer"
+	EncryptionRequire = "require"
+)
+
+var (
+	ErrUnknownEncryption            = errors.New("unknown encryption policy")
+	ErrInvalidListenPort            = errors.New("invalid listen port")
+	ErrCouldNotFindInterfaceAddress = errors.New("could not find address for interface")
+)
+
+type Network struct {
+	ListenPort   int
+	Interface    string
+	DisableDHT   bool
+	DisablePEX   bool
+	DisableUTP   bool
+	DisableTCP   bool
+	DisableIPv6  bool
+	Trackers     []string
+	Encryption   string
+	PeerIDPrefix string
+}
+
+func (n Network) isSet() bool {
+	return n.ListenPort != 0 || n.Interface != "" || n.DisableDHT || n.DisablePEX || n.DisableUTP || n.DisableTCP || n.DisableIPv6 || (n.Encryption != "" && n.Encryption != EncryptionPrefer) || n.PeerIDPrefix != ""
+}
+
+func (n Network) apply(cfg *torrent.ClientConfig) error {
+	if n.ListenPort < 0 || n.ListenPort > 65535 {
+		return fmt.Errorf("%w: %v", ErrInvalidListenPort, n.ListenPort)
+	}
+	cfg.ListenPort = n.ListenPort
+
+	var ipv4, ipv6 net.IP
+	if strings.TrimSpace(n.Interface) != "" {
+		var err error
+		ipv4, ipv6, err = getInterfaceIPs(n.Interface)
+		if err != nil {
+			return err
+		}
+
+		cfg.DisableIPv4 = ipv4 == nil
+		cfg.DisableIPv6 = ipv6 == nil
+		cfg.ListenHost = func(network string) string {
+			if strings.HasSuffix(network, "6") {
+				return ipv6.String()
+			}
+
+			return ipv4.String()
+		}
+	}
+
+	cfg.NoDHT = n.DisableDHT
+	cfg.DisablePEX = n.DisablePEX
+	cfg.DisableUTP = n.DisableUTP
+	cfg.DisableTCP = n.DisableTCP
+	cfg.DisableIPv6 = cfg.DisableIPv6 || n.DisableIPv6
+
+	if strings.TrimSpace(n.Interface) != "" || n.DisableIPv6 {
+		cfg.TrackerDialContext, cfg.TrackerListenPacket = getTrackerDialers(ipv4, ipv6, cfg.DisableIPv4, cfg.DisableIPv6)
+	}
+
+	switch n.Encryption {
+	case EncryptionNone:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        false,
+			RequirePreferred: true,
+		}
+	case EncryptionAllow:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        false,
+			RequirePreferred: false,
+		}
+	case "", EncryptionPrefer:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        true,
+			RequirePreferred: false,
+		}
+	case EncryptionRequire:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        true,
+			RequirePreferred: true,
+		}
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownEncryption, n.Encryption)
+	}
+
+	if strings.TrimSpace(n.PeerIDPrefix) != "" {
+		cfg.Bep20 = n.PeerIDPrefix
+	}
+
+	return nil
+}
+
+func (n Network) addTrackers(t *torrent.Torrent) {
+	trackers := []string{}
+	for _, tracker := range n.Trackers {
+		if tracker = strings.TrimSpace(tracker); tracker != "" {
+			trackers = append(trackers, tracker)
+		}
+	}
+
+	if len(trackers) == 0 {
+		return
+	}
+
+	t.AddTrackers([][]string{trackers})
+}
+
+func getInterfaceIPs(iface string) (ipv4 net.IP, ipv6 net.IP, err error) {
+	ips := []net.IP{}
+	if ip := net.ParseIP(iface); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		addrs, err := i.Addrs()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = ip
+			}
+		} else if ipv6 == nil && !ip.IsLinkLocalUnicast() {
+			ipv6 = ip
+		}
+	}
+
+	if ipv4 == nil && ipv6 == nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCouldNotFindInterfaceAddress, iface)
+	}
+
+	return ipv4, ipv6, nil
+}
+
+func getTrackerNetwork(network string, disableIPv4, disableIPv6 bool) string {
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		return network
+	}
+
+	if disableIPv6 {
+		return network + "4"
+	}
+
+	if disableIPv4 {
+		return network + "6"
+	}
+
+	return network
+}
+
+func getTrackerIP(network string, ipv4, ipv6 net.IP) net.IP {
+	if strings.HasSuffix(network, "6") || ipv4 == nil {
+		return ipv6
+	}
+
+	return ipv4
+}
+
+func getTrackerDialers(ipv4, ipv6 net.IP, disableIPv4, disableIPv6 bool) (func(ctx context.Context, network, addr string) (net.Conn, error), func(network, addr string) (net.PacketConn, error)) {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		network = getTrackerNetwork(network, disableIPv4, disableIPv6)
+
+		d := net.Dialer{}
+		if ip := getTrackerIP(network, ipv4, ipv6); ip != nil {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+
+		return d.DialContext(ctx, network, addr)
+	}
+
+	listen := func(network, addr string) (net.PacketConn, error) {
+		network = getTrackerNetwork(network, disableIPv4, disableIPv6)
+
+		if ip := getTrackerIP(network, ipv4, ipv6); ip != nil {
+			addr = net.JoinHostPort(ip.String(), "0")
+		}
+
+		return net.ListenPacket(network, addr)
+	}
+
+	return dial, listen
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"slices"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	PeerFlagSeed       = "seed"
+	PeerFlagFast       = "fast"
+	PeerFlagDHT        = "dht"
+	PeerFlagExtended   = "extended"
+	PeerFlagEncryption = "encryption"
+
+	maxPeerUploadRequests = 1024
+)
+
+type transferBlock struct {
+	piece     int
+	begin     int64
+	length    int64
+	requested time.Time
+}
+
+type peerStats struct {
+	choked     bool
+	interested bool
+	downloaded rateCounter
+	uploaded   rateCounter
+	requests   []transferBlock
+}
+
+func (g *Gateway) getPeerStats(pc *torrent.PeerConn) *peerStats {
+	stats, ok := g.peerStats[pc]
+	if !ok {
+		stats = &peerStats{
+			choked: true,
+		}
+
+		g.peerStats[pc] = stats
+	}
+
+	return stats
+}
+
+func (g *Gateway) onReadMessage(pc *torrent.PeerConn, msg *pp.Message) {
+	if msg.Keepalive {
+		return
+	}
+
+	g.peerStatsLock.Lock()
+	defer g.peerStatsLock.Unlock()
+
+	switch msg.Type {
+	case pp.Choke:
+		g.getPeerStats(pc).choked = true
+	case pp.Unchoke:
+		g.getPeerStats(pc).choked = false
+	case pp.Interested:
+		g.getPeerStats(pc).interested = true
+	case pp.NotInterested:
+		g.getPeerStats(pc).interested = false
+	case pp.Request:
+		stats := g.getPeerStats(pc)
+
+		stats.requests = append(stats.requests, transferBlock{
+			piece:     int(msg.Index),
+			begin:     int64(msg.Begin),
+			length:    int64(msg.Length),
+			requested: time.Now(),
+		})
+		if len(stats.requests) > maxPeerUploadRequests {
+			stats.requests = stats.requests[len(stats.requests)-maxPeerUploadRequests:]
+		}
+	case pp.Cancel:
+		stats := g.getPeerStats(pc)
+
+		stats.requests = slices.DeleteFunc(stats.requests, func(r transferBlock) bool {
+			return r.piece == int(msg.Index) && r.begin == int64(msg.Begin) && r.length == int64(msg.Length)
+		})
+	}
+}
+
+func (g *Gateway) onPeerReceivedUsefulData(e torrent.ReceivedUsefulDataEvent) {
+	pc, ok := e.Peer.TryAsPeerConn()
+	if !ok {
+		return
+	}
+
+	g.peerStatsLock.Lock()
+	defer g.peerStatsLock.Unlock()
+
+	g.getPeerStats(pc).downloaded.add(time.Now(), int64(len(e.Message.Piece)))
+}
+
+func (s *peerStats) consumeRequests(n int64) []transferBlock {
+	sent := []transferBlock{}
+	for n > 0 && len(s.requests) > 0 {
+		r := &s.requests[0]
+		m := min(n, r.length)
+
+		sent = append(sent, transferBlock{
+			piece:  r.piece,
+			begin:  r.begin,
+			length: m,
+		})
+
+		r.begin += m
+		r.length -= m
+		n -= m
+
+		if r.length <= 0 {
+			s.requests = s.requests[1:]
+		}
+	}
+
+	return sent
+}
+
+func (g *Gateway) addPeerUploads(t *torrent.Torrent, now time.Time, n int64) []transferBlock {
+	g.peerStatsLock.Lock()
+	defer g.peerStatsLock.Unlock()
+
+	peers := []*peerStats{}
+	pending := []int64{}
+	total := int64(0)
+	for _, pc := range t.PeerConns() {
+		stats, ok := g.peerStats[pc]
+		if !ok {
+			continue
+		}
+
+		stats.requests = slices.DeleteFunc(stats.requests, func(r transferBlock) bool {
+			return now.Sub(r.requested) > rateWindowSeconds*time.Second
+		})
+
+		p := int64(0)
+		for _, r := range stats.requests {
+			p += r.length
+		}
+
+		if p > 0 {
+			peers = append(peers, stats)
+			pending = append(pending, p)
+			total += p
+		}
+	}
+
+	sent := []transferBlock{}
+	for i, stats := range peers {
+		if n <= 0 || total <= 0 {
+			break
+		}
+
+		share := min(pending[i], n*pending[i]/total)
+		n -= share
+		total -= pending[i]
+
+		stats.uploaded.add(now, share)
+		sent = append(sent, stats.consumeRequests(share)...)
+	}
+
+	return sent
+}
+
+func (g *Gateway) onPeerConnClosed(pc *torrent.PeerConn) {
+	g.peerStatsLock.Lock()
+	defer g.peerStatsLock.Unlock()
+
+	delete(g.peerStats, pc)
+}
+
+func formatPeerSource(source torrent.PeerSource) string {
+	switch source {
+	case torrent.PeerSourceTracker:
+		return "tracker"
+	case torrent.PeerSourceIncoming:
+		return "incoming"
+	case torrent.PeerSourceDhtGetPeers, torrent.PeerSourceDhtAnnouncePeer:
+		return "dht"
+	case torrent.PeerSourcePex:
+		return "pex"
+	case torrent.PeerSourceDirect:
+		return "direct"
+	case torrent.PeerSourceUtHolepunch:
+		return "holepunch"
+	default:
+		return string(source)
+	}
+}
+
+func getPeerFlags(pc *torrent.PeerConn, pieces int, numPieces int) []string {
+	flags := []string{}
+	if numPieces > 0 && pieces >= numPieces {
+		flags = append(flags, PeerFlagSeed)
+	}
+
+	if pc.PeerExtensionBytes.SupportsFast() {
+		flags = append(flags, PeerFlagFast)
+	}
+
+	if pc.PeerExtensionBytes.SupportsDHT() {
+		flags = append(flags, PeerFlagDHT)
+	}
+
+	if pc.PeerExtensionBytes.SupportsExtended() {
+		flags = append(flags, PeerFlagExtended)
+	}
+
+	if pc.PeerPrefersEncryption {
+		flags = append(flags, PeerFlagEncryption)
+	}
+
+	return flags
+}
+
+func (g *Gateway) getPeerMetrics(t *torrent.Torrent) ([]v1.PeerMetrics, []v1.KnownPeer) {
+	numPieces := 0
+	if t.Info() != nil {
+		numPieces = t.NumPieces()
+	}
+
+	now := time.Now()
+
+	peers := []v1.PeerMetrics{}
+	addresses := map[string]struct{}{}
+	for _, pc := range t.PeerConns() {
+		address := pc.RemoteAddr.String()
+		addresses[address] = struct{}{}
+
+		client, _ := pc.PeerClientName.Load().(string)
+		pieces := int(pc.PeerPieces().GetCardinality())
+
+		peer := v1.PeerMetrics{
+			Address: address,
+			Network: pc.Network,
+			Source:  formatPeerSource(pc.Discovery),
+			Client:  client,
+			Pieces:  pieces,
+			Flags:   getPeerFlags(pc, pieces, numPieces),
+			Choked:  true,
+		}
+
+		g.peerStatsLock.Lock()
+		if stats, ok := g.peerStats[pc]; ok {
+			peer.DownloadRate = stats.downloaded.rate(now)
+			peer.EstimatedUploadRate = stats.uploaded.rate(now)
+			peer.Choked = stats.choked
+			peer.Interested = stats.interested
+		}
+		g.peerStatsLock.Unlock()
+
+		peers = append(peers, peer)
+	}
+
+	knownPeers := []v1.KnownPeer{}
+	for _, p := range t.KnownSwarm() {
+		if p.Addr == nil {
+			continue
+		}
+
+		address := p.Addr.String()
+		if _, ok := addresses[address]; ok {
+			continue
+		}
+		addresses[address] = struct{}{}
+
+		knownPeers = append(knownPeers, v1.KnownPeer{
+			Address: address,
+			Source:  formatPeerSource(p.Source),
+		})
+	}
+
+	return peers, knownPeers
+}
+
+func (g *Gateway) getSwarm(t *torrent.Torrent) v1.Swarm {
+	infoHash, infoHashV2 := getInfoHashes(t)
+	peers, knownPeers := g.getPeerMetrics(t)
+	stats := t.Stats()
+
+	return v1.Swarm{
+		InfoHash:         infoHash,
+		InfoHashV2:       infoHashV2,
+		ConnectedSeeders: stats.ConnectedSeeders,
+		HalfOpenPeers:    stats.HalfOpenPeers,
+		PendingPeers:     stats.PendingPeers,
+		Peers:            peers,
+		KnownPeers:       knownPeers,
+		Trackers:         g.getTrackerMetrics(t),
+	}
+}
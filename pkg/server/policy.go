@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrPolicyRejected = errors.New("rejected by policy")
+)
+
+type Policy struct {
+	AllowInfoHashes     []string `yaml:"allowInfoHashes"`
+	DenyInfoHashes      []string `yaml:"denyInfoHashes"`
+	AllowTrackerDomains []string `yaml:"allowTrackerDomains"`
+	DenyTrackerDomains  []string `yaml:"denyTrackerDomains"`
+	MaxSize             int64    `yaml:"maxSize"`
+	AllowExtensions     []string `yaml:"allowExtensions"`
+	DenyExtensions      []string `yaml:"denyExtensions"`
+}
+
+func LoadPolicy(policyFile string) (*Policy, error) {
+	policy := &Policy{}
+	if strings.TrimSpace(policyFile) == "" {
+		return policy, nil
+	}
+
+	f, err := os.Open(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) CheckMagnet(m metainfo.MagnetV2) error {
+	infoHashes := []string{}
+	if m.InfoHash.Ok {
+		infoHashes = append(infoHashes, m.InfoHash.Value.HexString())
+	}
+
+	if m.V2InfoHash.Ok {
+		infoHashes = append(infoHashes, m.V2InfoHash.Value.ToShort().HexString(), m.V2InfoHash.Value.HexString())
+	}
+
+	if err := p.CheckInfoHashes(infoHashes...); err != nil {
+		return err
+	}
+
+	for _, tracker := range m.Trackers {
+		u, err := url.Parse(tracker)
+		if err != nil {
+			return fmt.Errorf("%w: could not parse tracker %v: %v", ErrPolicyRejected, tracker, err)
+		}
+
+		if matchesDomain(p.DenyTrackerDomains, u.Hostname()) {
+			return fmt.Errorf("%w: tracker domain %v is denied", ErrPolicyRejected, u.Hostname())
+		}
+
+		if len(p.AllowTrackerDomains) > 0 && !matchesDomain(p.AllowTrackerDomains, u.Hostname()) {
+			return fmt.Errorf("%w: tracker domain %v is not allowed", ErrPolicyRejected, u.Hostname())
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) CheckInfoHashes(infoHashes ...string) error {
+	allowed := len(p.AllowInfoHashes) == 0
+	for _, infoHash := range infoHashes {
+		if infoHash == "" {
+			continue
+		}
+
+		if containsFold(p.DenyInfoHashes, infoHash) {
+			return fmt.Errorf("%w: infohash %v is denied", ErrPolicyRejected, infoHash)
+		}
+
+		if containsFold(p.AllowInfoHashes, infoHash) {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		return fmt.Errorf("%w: infohash %v is not allowed", ErrPolicyRejected, strings.Join(infoHashes, ", "))
+	}
+
+	return nil
+}
+
+func (p *Policy) CheckInfo(info *metainfo.Info) error {
+	if size := info.TotalLength(); p.MaxSize > 0 && size > p.MaxSize {
+		return fmt.Errorf("%w: size %v exceeds maximum size %v", ErrPolicyRejected, size, p.MaxSize)
+	}
+
+	for _, f := range info.UpvertedFiles() {
+		ext := path.Ext(f.DisplayPath(info))
+
+		if matchesExtension(p.DenyExtensions, ext) {
+			return fmt.Errorf("%w: extension %v is denied", ErrPolicyRejected, ext)
+		}
+
+		if len(p.AllowExtensions) > 0 && !matchesExtension(p.AllowExtensions, ext) {
+			return fmt.Errorf("%w: extension %v is not allowed", ErrPolicyRejected, ext)
+		}
+	}
+
+	return nil
+}
+
+func containsFold(candidates []string, value string) bool {
+	for _, candidate := range candidates {
+		if strings.EqualFold(strings.TrimSpace(candidate), value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesExtension(extensions []string, ext string) bool {
+	for _, extension := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(extension), "."), strings.TrimPrefix(ext, ".")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.TrimSpace(domain), ".")
+
+		if strings.EqualFold(host, domain) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+
+	return false
+}
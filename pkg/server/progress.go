@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	defaultProgressInterval = time.Millisecond * 100
+	progressEventBuffer     = 64
+)
+
+type progressKey struct {
+	infoHash metainfo.Hash
+	index    int
+}
+
+type fileProgress struct {
+	magnetLink string
+	f          *torrent.File
+	index      int
+
+	streams int
+	done    chan struct{}
+}
+
+type progressSubscriber struct {
+	onProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics)
+}
+
+type progressTracker struct {
+	interval time.Duration
+	collect  func(magnetLink string, f *torrent.File, index int) (v1.TorrentMetrics, v1.FileMetrics)
+	ctx      context.Context
+
+	lock        sync.Mutex
+	files       map[progressKey]*fileProgress
+	subscribers map[*progressSubscriber]struct{}
+}
+
+func newProgressTracker(
+	interval time.Duration,
+	collect func(magnetLink string, f *torrent.File, index int) (v1.TorrentMetrics, v1.FileMetrics),
+	ctx context.Context,
+) *progressTracker {
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	return &progressTracker{
+		interval: interval,
+		collect:  collect,
+		ctx:      ctx,
+
+		files:       map[progressKey]*fileProgress{},
+		subscribers: map[*progressSubscriber]struct{}{},
+	}
+}
+
+func (p *progressTracker) subscribe(onProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics)) func() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := &progressSubscriber{
+		onProgress: onProgress,
+	}
+	p.subscribers[s] = struct{}{}
+
+	return func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		delete(p.subscribers, s)
+	}
+}
+
+func (p *progressTracker) track(magnetLink string, f *torrent.File, index int) func() {
+	key := progressKey{
+		infoHash: f.Torrent().InfoHash(),
+		index:    index,
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fp, ok := p.files[key]
+	if !ok {
+		fp = &fileProgress{
+			magnetLink: magnetLink,
+			f:          f,
+			index:      index,
+
+			done: make(chan struct{}),
+		}
+		p.files[key] = fp
+
+		go p.run(fp)
+	}
+	fp.streams++
+
+	return func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		fp.streams--
+		if fp.streams > 0 {
+			return
+		}
+
+		close(fp.done)
+		delete(p.files, key)
+	}
+}
+
+func (p *progressTracker) run(fp *fileProgress) {
+	tick := time.NewTicker(p.interval)
+	defer tick.Stop()
+
+	lastCompleted := fp.f.BytesCompleted()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-fp.done:
+			return
+		case <-tick.C:
+			completed, length := fp.f.BytesCompleted(), fp.f.Length()
+			if completed >= length {
+				return
+			}
+
+			if completed == lastCompleted {
+				continue
+			}
+			lastCompleted = completed
+
+			p.publish(fp)
+		}
+	}
+}
+
+func (p *progressTracker) publish(fp *fileProgress) {
+	torrentMetrics, fileMetrics := p.collect(fp.magnetLink, fp.f, fp.index)
+
+	p.lock.Lock()
+	subscribers := make([]*progressSubscriber, 0, len(p.subscribers))
+	for s := range p.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	p.lock.Unlock()
+
+	for _, s := range subscribers {
+		s.onProgress(torrentMetrics, fileMetrics)
+	}
+}
+
+func (g *Gateway) getProgressMetrics(magnetLink string, f *torrent.File, index int) (v1.TorrentMetrics, v1.FileMetrics) {
+	t := f.Torrent()
+	infoHash, infoHashV2 := getInfoHashes(t)
+	torrentDownloadRate, torrentUploadRate := g.getRates(t.InfoHash(), -1)
+
+	torrentMetrics := v1.TorrentMetrics{
+		Magnet:       magnetLink,
+		InfoHash:     infoHash,
+		InfoHashV2:   infoHashV2,
+		Peers:        len(t.PeerConns()),
+		DownloadRate: torrentDownloadRate,
+		UploadRate:   torrentUploadRate,
+		Streams:      []v1.StreamMetrics{},
+		Files:        []v1.FileMetrics{},
+	}
+
+	return torrentMetrics, g.getFileMetrics(t, f, index)
+}
+
+func (g *Gateway) getFileMetrics(t *torrent.Torrent, f *torrent.File, index int) v1.FileMetrics {
+	completed := f.BytesCompleted()
+	downloadRate, uploadRate := g.getRates(t.InfoHash(), index)
+
+	return v1.FileMetrics{
+		Index:        index,
+		Path:         f.Path(),
+		Length:       f.Length(),
+		Completed:    completed,
+		Priority:     formatPriority(f.Priority()),
+		PiecesRoot:   getPiecesRoot(f),
+		DownloadRate: downloadRate,
+		UploadRate:   uploadRate,
+		ETA:          getETA(f.Length()-completed, downloadRate),
+	}
+}
+
+func (g *Gateway) SubscribeProgress(onProgress func(torrentMetrics v1.TorrentMetrics, fileMetrics v1.FileMetrics)) func() {
+	return g.progress.subscribe(onProgress)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	rateWindowSeconds  = 10
+	rateSampleInterval = time.Second
+)
+
+type rateCounter struct {
+	buckets [rateWindowSeconds]int64
+	seconds [rateWindowSeconds]int64
+}
+
+func (c *rateCounter) add(now time.Time, n int64) {
+	second := now.Unix()
+	i := second % rateWindowSeconds
+
+	if c.seconds[i] != second {
+		c.seconds[i] = second
+		c.buckets[i] = 0
+	}
+
+	c.buckets[i] += n
+}
+
+func (c *rateCounter) rate(now time.Time) int64 {
+	second := now.Unix()
+
+	total := int64(0)
+	for i, s := range c.seconds {
+		if s < second && s >= second-rateWindowSeconds {
+			total += c.buckets[i]
+		}
+	}
+
+	return total / rateWindowSeconds
+}
+
+type transferRates struct {
+	downloaded rateCounter
+	uploaded   rateCounter
+}
+
+type torrentRates struct {
+	transferRates
+
+	files   map[int]*transferRates
+	written int64
+}
+
+func getETA(remaining int64, rate int64) int64 {
+	if remaining <= 0 {
+		return 0
+	}
+
+	if rate <= 0 {
+		return -1
+	}
+
+	return (remaining + rate - 1) / rate
+}
+
+func (g *Gateway) addTransfer(t *torrent.Torrent, now time.Time, n int64, blocks []transferBlock, uploaded bool) {
+	info := t.Info()
+	if info == nil || n <= 0 {
+		return
+	}
+
+	g.ratesLock.Lock()
+	defer g.ratesLock.Unlock()
+
+	rates := g.getTorrentRates(t.InfoHash())
+
+	add := func(r *transferRates, n int64) {
+		if uploaded {
+			r.uploaded.add(now, n)
+		} else {
+			r.downloaded.add(now, n)
+		}
+	}
+
+	add(&rates.transferRates, n)
+
+	files := t.Files()
+	for _, block := range blocks {
+		start := int64(block.piece)*info.PieceLength + block.begin
+		end := start + block.length
+
+		first := sort.Search(len(files), func(i int) bool {
+			return files[i].Offset()+files[i].Length() > start
+		})
+
+		for i := first; i < len(files) && files[i].Offset() < end; i++ {
+			overlap := min(end, files[i].Offset()+files[i].Length()) - max(start, files[i].Offset())
+			if overlap <= 0 {
+				continue
+			}
+
+			fileRates, ok := rates.files[i]
+			if !ok {
+				fileRates = &transferRates{}
+
+				rates.files[i] = fileRates
+			}
+
+			add(fileRates, overlap)
+		}
+	}
+}
+
+func (g *Gateway) getTorrentRates(infoHash metainfo.Hash) *torrentRates {
+	rates, ok := g.rates[infoHash]
+	if !ok {
+		rates = &torrentRates{
+			files: map[int]*transferRates{},
+		}
+
+		g.rates[infoHash] = rates
+	}
+
+	return rates
+}
+
+func (g *Gateway) onReceivedTransfer(e torrent.ReceivedUsefulDataEvent) {
+	n := int64(len(e.Message.Piece))
+
+	g.addTransfer(e.Peer.Torrent(), time.Now(), n, []transferBlock{{
+		piece:  int(e.Message.Index),
+		begin:  int64(e.Message.Begin),
+		length: n,
+	}}, false)
+}
+
+func (g *Gateway) monitorRates() {
+	tick := time.NewTicker(rateSampleInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.closed:
+			return
+		case now := <-tick.C:
+			for _, t := range g.torrentClient.Torrents() {
+				g.sampleUploads(t, now)
+			}
+		}
+	}
+}
+
+func (g *Gateway) sampleUploads(t *torrent.Torrent, now time.Time) {
+	stats := t.Stats()
+	written := stats.BytesWrittenData.Int64()
+
+	g.ratesLock.Lock()
+	rates := g.getTorrentRates(t.InfoHash())
+	n := written - rates.written
+	rates.written = written
+	g.ratesLock.Unlock()
+
+	g.addTransfer(t, now, n, g.addPeerUploads(t, now, n), true)
+}
+
+func (g *Gateway) getRates(infoHash metainfo.Hash, index int) (downloadRate int64, uploadRate int64) {
+	g.ratesLock.Lock()
+	defer g.ratesLock.Unlock()
+
+	rates, ok := g.rates[infoHash]
+	if !ok {
+		return 0, 0
+	}
+
+	r := &rates.transferRates
+	if index >= 0 {
+		r, ok = rates.files[index]
+		if !ok {
+			return 0, 0
+		}
+	}
+
+	now := time.Now()
+
+	return r.downloaded.rate(now), r.uploaded.rate(now)
+}
+
+func (g *Gateway) forgetRates(infoHash metainfo.Hash) {
+	g.ratesLock.Lock()
+	defer g.ratesLock.Unlock()
+
+	delete(g.rates, infoHash)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	streamReadaheadPieces = 4
+)
+
+var (
+	ErrTorrentClosed = errors.New("torrent was closed")
+	ErrInvalidSeek   = errors.New("invalid seek")
+)
+
+type contextReader struct {
+	torrent.Reader
+
+	ctx context.Context
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	return r.ReadContext(r.ctx, p)
+}
+
+type pieceReader struct {
+	ctx context.Context
+	g   *Gateway
+	t   *torrent.Torrent
+
+	offset      int64
+	length      int64
+	pieceLength int64
+	endPiece    int
+
+	pos    int64
+	index  int
+	pieces map[int]torrent.PiecePriority
+}
+
+func (g *Gateway) newFileReader(ctx context.Context, f *torrent.File) io.ReadSeekCloser {
+	t := f.Torrent()
+	if info := t.Info(); info != nil && f.Offset()+f.Length() > t.Length() {
+		return &pieceReader{
+			ctx: ctx,
+			g:   g,
+			t:   t,
+
+			offset:      f.Offset(),
+			length:      f.Length(),
+			pieceLength: info.PieceLength,
+			endPiece:    f.EndPieceIndex(),
+		}
+	}
+
+	return &contextReader{
+		Reader: f.NewReader(),
+
+		ctx: ctx,
+	}
+}
+
+func (r *pieceReader) Read(p []byte) (int, error) {
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+
+	off := r.offset + r.pos
+	index := int(off / r.pieceLength)
+
+	r.prioritize(index)
+
+	if err := r.waitForPiece(index); err != nil {
+		return 0, err
+	}
+
+	pieceOffset := int64(index) * r.pieceLength
+	p = p[:min(int64(len(p)), pieceOffset+r.pieceLength-off, r.length-r.pos)]
+
+	n, err := r.t.Piece(index).Storage().ReadAt(p, off-pieceOffset)
+	r.pos += int64(n)
+
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (r *pieceReader) prioritize(index int) {
+	if r.pieces != nil && r.index == index {
+		return
+	}
+	r.index = index
+
+	pieces := map[int]torrent.PiecePriority{}
+	for i := index; i < min(index+1+streamReadaheadPieces, r.endPiece); i++ {
+		pieces[i] = torrent.PiecePriorityReadahead
+	}
+	pieces[index] = torrent.PiecePriorityNow
+
+	r.setPieces(pieces)
+}
+
+func (r *pieceReader) setPieces(pieces map[int]torrent.PiecePriority) {
+	r.g.pieceReadersLock.Lock()
+	defer r.g.pieceReadersLock.Unlock()
+
+	changed := map[int]torrent.PiecePriority{}
+	maps.Copy(changed, r.pieces)
+	for i, priority := range pieces {
+		if changed[i] != priority {
+			changed[i] = priority
+		} else {
+			delete(changed, i)
+		}
+	}
+
+	r.pieces = pieces
+	if pieces == nil {
+		delete(r.g.pieceReaders, r)
+	} else {
+		r.g.pieceReaders[r] = struct{}{}
+	}
+
+	for i := range changed {
+		priority := torrent.PiecePriorityNone
+		for other := range r.g.pieceReaders {
+			if other.t == r.t {
+				priority.Raise(other.pieces[i])
+			}
+		}
+
+		r.t.Piece(i).SetPriority(priority)
+	}
+}
+
+func (r *pieceReader) waitForPiece(index int) error {
+	sub := r.t.SubscribePieceStateChanges()
+	defer sub.Close()
+
+	for !r.t.PieceState(index).Complete {
+		select {
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		case <-r.t.Closed():
+			return ErrTorrentClosed
+		case <-sub.Values:
+		}
+	}
+
+	return nil
+}
+
+func (r *pieceReader) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		pos += r.pos
+	case io.SeekEnd:
+		pos += r.length
+	default:
+		return 0, ErrInvalidSeek
+	}
+
+	if pos < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	if pos != r.pos {
+		r.setPieces(nil)
+	}
+	r.pos = pos
+
+	return pos, nil
+}
+
+func (r *pieceReader) Close() error {
+	r.setPieces(nil)
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ClusterModeProxy    = "proxy"
+	ClusterModeRedirect = "redirect"
+
+	forwardedHeader          = "X-HTorrent-Forwarded"
+	forwardedSignatureHeader = "X-HTorrent-Forwarded-Signature"
+	forwardedMaxAge          = time.Minute
+
+	registryKeyPrefix     = "htorrent:"
+	registryOwnerTTL      = time.Second * 30
+	registryClaimInterval = time.Second * 10
+)
+
+var (
+	ErrUnknownClusterMode   = errors.New("unknown cluster mode")
+	ErrMissingAdvertiseURL  = errors.New("missing advertise URL for cluster mode")
+	ErrMissingClusterSecret = errors.New("missing cluster secret for cluster mode")
+	ErrUnknownRegistry      = errors.New("unknown registry, expected a redis:// or rediss:// URL")
+	ErrForwardedToOwner     = errors.New("forwarded request to owner of torrent")
+)
+
+type Cluster struct {
+	Registry     string
+	AdvertiseURL string
+	Mode         string
+	Secret       string
+}
+
+type Registry interface {
+	GetMetainfo(ctx context.Context, infoHash metainfo.Hash) ([]byte, error)
+	SetMetainfo(ctx context.Context, infoHash metainfo.Hash, mi []byte) error
+	GetOwner(ctx context.Context, infoHash metainfo.Hash) (string, error)
+	ClaimOwner(ctx context.Context, infoHash metainfo.Hash, instance string, ttl time.Duration) (string, error)
+	ReleaseOwner(ctx context.Context, infoHash metainfo.Hash, instance string) error
+	Close() error
+}
+
+func NewRegistry(registryURL string) (Registry, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "redis", "rediss":
+		return NewRedisRegistry(registryURL)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownRegistry, registryURL)
+	}
+}
+
+var (
+	claimOwnerScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if not owner or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return ARGV[1]
+end
+return owner
+`)
+	releaseOwnerScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+type redisRegistry struct {
+	client *redis.Client
+}
+
+func NewRedisRegistry(registryURL string) (Registry, error) {
+	opts, err := redis.ParseURL(registryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+
+		return nil, err
+	}
+
+	return &redisRegistry{
+		client: client,
+	}, nil
+}
+
+func getRegistryMetainfoKey(infoHash metainfo.Hash) string {
+	return registryKeyPrefix + "metainfo:" + infoHash.HexString()
+}
+
+func getRegistryOwnerKey(infoHash metainfo.Hash) string {
+	return registryKeyPrefix + "owner:" + infoHash.HexString()
+}
+
+func (r *redisRegistry) GetMetainfo(ctx context.Context, infoHash metainfo.Hash) ([]byte, error) {
+	mi, err := r.client.Get(ctx, getRegistryMetainfoKey(infoHash)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	return mi, err
+}
+
+func (r *redisRegistry) SetMetainfo(ctx context.Context, infoHash metainfo.Hash, mi []byte) error {
+	return r.client.Set(ctx, getRegistryMetainfoKey(infoHash), mi, 0).Err()
+}
+
+func (r *redisRegistry) GetOwner(ctx context.Context, infoHash metainfo.Hash) (string, error) {
+	owner, err := r.client.Get(ctx, getRegistryOwnerKey(infoHash)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+
+	return owner, err
+}
+
+func (r *redisRegistry) ClaimOwner(ctx context.Context, infoHash metainfo.Hash, instance string, ttl time.Duration) (string, error) {
+	return claimOwnerScript.Run(ctx, r.client, []string{getRegistryOwnerKey(infoHash)}, instance, ttl.Milliseconds()).Text()
+}
+
+func (r *redisRegistry) ReleaseOwner(ctx context.Context, infoHash metainfo.Hash, instance string) error {
+	return releaseOwnerScript.Run(ctx, r.client, []string{getRegistryOwnerKey(infoHash)}, instance).Err()
+}
+
+func (r *redisRegistry) Close() error {
+	return r.client.Close()
+}
+
+func (c Cluster) validate() error {
+	switch c.Mode {
+	case "", ClusterModeProxy, ClusterModeRedirect:
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownClusterMode, c.Mode)
+	}
+
+	if strings.TrimSpace(c.AdvertiseURL) == "" {
+		return ErrMissingAdvertiseURL
+	}
+
+	if c.Secret == "" {
+		return ErrMissingClusterSecret
+	}
+
+	_, err := url.Parse(c.AdvertiseURL)
+
+	return err
+}
+
+func (c Cluster) signForward(instance string, signed time.Time) string {
+	timestamp := strconv.FormatInt(signed.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	_, _ = mac.Write([]byte(instance + "\n" + timestamp))
+
+	return timestamp + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c Cluster) isForwarded(r *http.Request) bool {
+	instance := r.Header.Get(forwardedHeader)
+	signature := r.Header.Get(forwardedSignatureHeader)
+
+	timestamp, _, ok := strings.Cut(signature, ".")
+	if instance == "" || !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	signed := time.Unix(unix, 0)
+	if age := time.Since(signed); age > forwardedMaxAge || age < -forwardedMaxAge {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(c.signForward(instance, signed)))
+}
+
+func (g *Gateway) forwardToOwner(w http.ResponseWriter, r *http.Request, infoHash metainfo.Hash) {
+	if g.registry == nil || g.cluster.isForwarded(r) {
+		return
+	}
+
+	owner, err := g.registry.GetOwner(r.Context(), infoHash)
+	if err != nil {
+		g.log.Error().
+			Err(err).
+			Str("infohash", infoHash.HexString()).
+			Msg("Could not get owner of torrent from registry, serving locally")
+
+		return
+	}
+
+	if owner == "" || owner == g.cluster.AdvertiseURL {
+		return
+	}
+
+	target, err := url.Parse(owner)
+	if err != nil {
+		g.log.Error().
+			Err(err).
+			Str("owner", owner).
+			Msg("Could not parse owner of torrent, serving locally")
+
+		return
+	}
+
+	g.log.Debug().
+		Str("infohash", infoHash.HexString()).
+		Str("owner", owner).
+		Str("mode", g.cluster.Mode).
+		Msg("Forwarding request to owner of torrent")
+
+	if g.cluster.Mode == ClusterModeRedirect {
+		redirect := *target
+		redirect.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+		redirect.RawQuery = r.URL.RawQuery
+
+		http.Redirect(w, r, redirect.String(), http.StatusTemporaryRedirect)
+
+		panic(ErrForwardedToOwner)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, g.cluster.AdvertiseURL)
+			pr.Out.Header.Set(forwardedSignatureHeader, g.cluster.signForward(g.cluster.AdvertiseURL, time.Now()))
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			g.log.Error().
+				Err(err).
+				Str("owner", owner).
+				Msg("Could not reach owner of torrent")
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+
+	panic(ErrForwardedToOwner)
+}
+
+func (g *Gateway) addTorrentFromRegistry(magnetLink string, infoHash metainfo.Hash) (*torrent.Torrent, error) {
+	if g.registry == nil {
+		return g.addMagnet(magnetLink)
+	}
+
+	rawMetainfo, err := g.registry.GetMetainfo(g.ctx, infoHash)
+	if err != nil {
+		g.log.Error().
+			Err(err).
+			Str("infohash", infoHash.HexString()).
+			Msg("Could not get metainfo from registry, resolving it from peers")
+
+		return g.addMagnet(magnetLink)
+	}
+
+	if rawMetainfo == nil {
+		return g.addMagnet(magnetLink)
+	}
+
+	mi, err := decodeMetainfo(rawMetainfo)
+	if err != nil {
+		return nil, err
+	}
+
+	g.log.Debug().
+		Str("infohash", infoHash.HexString()).
+		Msg("Got metainfo from registry")
+
+	t, err := g.addMetainfo(mi)
+	if err != nil {
+		return nil, err
+	}
+
+	addMagnetSources(t, magnetLink)
+
+	return t, nil
+}
+
+func (g *Gateway) registerTorrent(t *torrent.Torrent) error {
+	if g.registry == nil || t.Info() == nil {
+		return nil
+	}
+
+	mi, err := encodeMetainfo(t.Metainfo())
+	if err != nil {
+		return err
+	}
+
+	for _, infoHash := range getShortInfoHashes(t) {
+		if err := g.registry.SetMetainfo(g.ctx, infoHash, mi); err != nil {
+			return err
+		}
+
+		if _, err := g.registry.ClaimOwner(g.ctx, infoHash, g.cluster.AdvertiseURL, registryOwnerTTL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) unregisterTorrent(t *torrent.Torrent) error {
+	if g.registry == nil {
+		return nil
+	}
+
+	for _, infoHash := range getShortInfoHashes(t) {
+		if err := g.registry.ReleaseOwner(g.ctx, infoHash, g.cluster.AdvertiseURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) claimAllTorrents() {
+	for _, t := range g.torrentClient.Torrents() {
+		if t.Info() == nil {
+			continue
+		}
+
+		for _, infoHash := range getShortInfoHashes(t) {
+			if _, err := g.registry.ClaimOwner(g.ctx, infoHash, g.cluster.AdvertiseURL, registryOwnerTTL); err != nil {
+				g.log.Error().
+					Err(err).
+					Str("infohash", infoHash.HexString()).
+					Msg("Could not claim torrent in registry")
+			}
+		}
+	}
+}
+
+func (g *Gateway) releaseAllTorrents() {
+	for _, t := range g.torrentClient.Torrents() {
+		if err := g.unregisterTorrent(t); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("infohash", t.InfoHash().HexString()).
+				Msg("Could not release torrent in registry")
+		}
+	}
+}
+
+func (g *Gateway) monitorRegistry() {
+	tick := time.NewTicker(registryClaimInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.closed:
+			return
+		case <-tick.C:
+			g.claimAllTorrents()
+		}
+	}
+}
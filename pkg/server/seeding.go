@@ -0,0 +1,236 @@
+package server
+
+import (
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	seedingCheckInterval = time.Second * 10
+)
+
+type Seeding struct {
+	Disabled bool
+	Ratio    float64
+	Duration time.Duration
+}
+
+func (s Seeding) isDone(ratio float64, seedingSince time.Time) bool {
+	if s.Disabled {
+		return true
+	}
+
+	if s.Ratio > 0 && ratio >= s.Ratio {
+		return true
+	}
+
+	if s.Duration > 0 && time.Since(seedingSince) >= s.Duration {
+		return true
+	}
+
+	return false
+}
+
+type seedingState struct {
+	policy            *Seeding
+	uploaded          int64
+	persistedUploaded int64
+	seedingSince      time.Time
+	done              bool
+}
+
+func (g *Gateway) getSeedingState(infoHash metainfo.Hash) *seedingState {
+	state, ok := g.seedingStates[infoHash]
+	if !ok {
+		state = &seedingState{}
+
+		g.seedingStates[infoHash] = state
+	}
+
+	return state
+}
+
+func (g *Gateway) getSeedingPolicy(infoHash metainfo.Hash) Seeding {
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	if state := g.getSeedingState(infoHash); state.policy != nil {
+		return *state.policy
+	}
+
+	return g.seeding
+}
+
+func (g *Gateway) getUploaded(t *torrent.Torrent) int64 {
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	stats := t.Stats()
+
+	return g.getSeedingState(t.InfoHash()).uploaded + stats.BytesWrittenData.Int64()
+}
+
+func (g *Gateway) getRatio(t *torrent.Torrent) float64 {
+	if t.Info() == nil || t.Length() == 0 {
+		return 0
+	}
+
+	return float64(g.getUploaded(t)) / float64(t.Length())
+}
+
+func (g *Gateway) isSeeding(t *torrent.Torrent) bool {
+	if t.Info() == nil || t.BytesMissing() > 0 || g.isPaused(t.InfoHash()) {
+		return false
+	}
+
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	return !g.getSeedingState(t.InfoHash()).done
+}
+
+func (g *Gateway) isSeedingDone(infoHash metainfo.Hash) bool {
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	return g.getSeedingState(infoHash).done
+}
+
+func (g *Gateway) setSeeding(t *torrent.Torrent, seeding Seeding) error {
+	g.seedingLock.Lock()
+	g.getSeedingState(t.InfoHash()).policy = &seeding
+	g.seedingLock.Unlock()
+
+	if g.session != nil {
+		if err := g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+			st.Seeding = &sessionSeeding{
+				Enabled:  !seeding.Disabled,
+				Ratio:    seeding.Ratio,
+				Duration: seeding.Duration.String(),
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	return g.checkSeeding(t)
+}
+
+func (g *Gateway) checkSeeding(t *torrent.Torrent) error {
+	select {
+	case <-t.Closed():
+		return nil
+	default:
+	}
+
+	if t.Info() == nil {
+		return nil
+	}
+
+	infoHash := t.InfoHash()
+	uploaded := g.getUploaded(t)
+	ratio := g.getRatio(t)
+	policy := g.getSeedingPolicy(infoHash)
+
+	g.seedingLock.Lock()
+	state := g.getSeedingState(infoHash)
+
+	startedSeeding := false
+	if t.BytesMissing() == 0 && state.seedingSince.IsZero() {
+		state.seedingSince = time.Now()
+
+		startedSeeding = true
+	}
+
+	done := !state.seedingSince.IsZero() && policy.isDone(ratio, state.seedingSince)
+	changed := done != state.done
+	state.done = done
+
+	persist := startedSeeding || uploaded != state.persistedUploaded
+	state.persistedUploaded = uploaded
+	seedingSince := state.seedingSince
+	g.seedingLock.Unlock()
+
+	if changed {
+		g.log.Debug().
+			Str("infohash", infoHash.HexString()).
+			Float64("ratio", ratio).
+			Bool("done", done).
+			Msg("Seeding state changed")
+
+		g.updateUpload(t)
+	}
+
+	if !persist || g.session == nil {
+		return nil
+	}
+
+	return g.session.update(infoHash, func(st *sessionTorrent) {
+		st.Uploaded = uploaded
+		st.SeedingSince = seedingSince.Unix()
+	})
+}
+
+func (g *Gateway) restoreSeeding(infoHash metainfo.Hash, st sessionTorrent) error {
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	state := g.getSeedingState(infoHash)
+	state.uploaded = st.Uploaded
+	state.persistedUploaded = st.Uploaded
+
+	if st.SeedingSince > 0 {
+		state.seedingSince = time.Unix(st.SeedingSince, 0)
+	}
+
+	if st.Seeding != nil {
+		duration, err := time.ParseDuration(st.Seeding.Duration)
+		if err != nil {
+			return err
+		}
+
+		state.policy = &Seeding{
+			Disabled: !st.Seeding.Enabled,
+			Ratio:    st.Seeding.Ratio,
+			Duration: duration,
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) forgetSeeding(infoHash metainfo.Hash) {
+	g.seedingLock.Lock()
+	defer g.seedingLock.Unlock()
+
+	delete(g.seedingStates, infoHash)
+}
+
+func (g *Gateway) monitorSeeding() {
+	tick := time.NewTicker(seedingCheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.closed:
+			return
+		case <-tick.C:
+			g.checkAllSeeding()
+		}
+	}
+}
+
+func (g *Gateway) checkAllSeeding() {
+	for _, t := range g.torrentClient.Torrents() {
+		if err := g.checkSeeding(t); err != nil {
+			g.log.Error().
+				Err(err).
+				Str("infohash", t.InfoHash().HexString()).
+				Msg("Could not check seeding state")
+		}
+	}
+}
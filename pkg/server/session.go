@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	sessionTorrentsBucket = []byte("torrents")
+)
+
+type sessionSeeding struct {
+	Enabled  bool    `json:"enabled"`
+	Ratio    float64 `json:"ratio"`
+	Duration string  `json:"duration"`
+}
+
+type sessionTorrent struct {
+	Magnet       string          `json:"magnet"`
+	Metainfo     []byte          `json:"metainfo,omitempty"`
+	Paused       bool            `json:"paused"`
+	Priorities   map[int]string  `json:"priorities,omitempty"`
+	SelectOnly   string          `json:"selectOnly,omitempty"`
+	Seeding      *sessionSeeding `json:"seeding,omitempty"`
+	Uploaded     int64           `json:"uploaded"`
+	SeedingSince int64           `json:"seedingSince,omitempty"`
+	DownloadRate int             `json:"downloadRate,omitempty"`
+	UploadRate   int             `json:"uploadRate,omitempty"`
+	WebSeeds     []string        `json:"webSeeds,omitempty"`
+	SeedPath     string          `json:"seedPath,omitempty"`
+}
+
+type session struct {
+	path string
+	db   *bbolt.DB
+}
+
+func newSession(path string) *session {
+	return &session{
+		path: path,
+	}
+}
+
+func (s *session) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	db, err := bbolt.Open(s.path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	s.db = db
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionTorrentsBucket)
+
+		return err
+	})
+}
+
+func (s *session) list() (map[metainfo.Hash]sessionTorrent, error) {
+	torrents := map[metainfo.Hash]sessionTorrent{}
+	if err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionTorrentsBucket).ForEach(func(k, v []byte) error {
+			var t sessionTorrent
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+
+			torrents[metainfo.NewHashFromHex(string(k))] = t
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return torrents, nil
+}
+
+func (s *session) update(infoHash metainfo.Hash, onUpdate func(t *sessionTorrent)) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(sessionTorrentsBucket)
+
+		var t sessionTorrent
+		if v := b.Get([]byte(infoHash.HexString())); v != nil {
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+		}
+
+		onUpdate(&t)
+
+		v, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(infoHash.HexString()), v)
+	})
+}
+
+func (s *session) remove(infoHash metainfo.Hash) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionTorrentsBucket).Delete([]byte(infoHash.HexString()))
+	})
+}
+
+func (s *session) close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func encodeMetainfo(mi metainfo.MetaInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeMetainfo(b []byte) (*metainfo.MetaInfo, error) {
+	return metainfo.Load(bytes.NewReader(b))
+}
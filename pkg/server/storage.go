@@ -0,0 +1,300 @@
+package server
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const (
+	StorageFile   = "file"
+	StorageMMap   = "mmap"
+	StorageSQLite = "sqlite"
+	StorageBolt   = "bolt"
+	StorageMemory = "memory"
+	StorageS3     = "s3"
+)
+
+var (
+	ErrUnknownStorage         = errors.New("unknown storage backend")
+	ErrMissingStorageCapacity = errors.New("missing capacity for in-memory storage")
+	ErrUnsupportedCapacity    = errors.New("storage backend does not support a capacity")
+	ErrPieceEvicted           = errors.New("piece has been evicted from storage")
+)
+
+func NewStorage(backend string, dir string, capacity int64, s3 S3) (storage.ClientImplCloser, error) {
+	switch backend {
+	case "", StorageFile, StorageMMap, StorageBolt:
+		if capacity > 0 {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedCapacity, backend)
+		}
+	}
+
+	switch backend {
+	case "", StorageFile, StorageMMap, StorageSQLite, StorageBolt, StorageS3:
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	switch backend {
+	case "", StorageFile:
+		completion, err := storage.NewDefaultPieceCompletionForDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		return storage.NewFileOpts(storage.NewFileClientOpts{
+			ClientBaseDir: dir,
+			TorrentDirMaker: func(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string {
+				return filepath.Join(baseDir, infoHash.HexString())
+			},
+			PieceCompletion: completion,
+		}), nil
+
+	case StorageMMap:
+		completion, err := storage.NewDefaultPieceCompletionForDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mmapStorage{
+			dir:        dir,
+			completion: completion,
+		}, nil
+
+	case StorageSQLite:
+		return newSQLiteStorage(filepath.Join(dir, "pieces.db"), capacity)
+
+	case StorageBolt:
+		return storage.NewBoltDB(dir), nil
+
+	case StorageMemory:
+		if capacity <= 0 {
+			return nil, ErrMissingStorageCapacity
+		}
+
+		return newMemoryStorage(capacity), nil
+
+	case StorageS3:
+		return newS3Storage(s3, dir, capacity)
+
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownStorage, backend)
+	}
+}
+
+type mmapStorage struct {
+	dir        string
+	completion storage.PieceCompletion
+}
+
+func (s *mmapStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	return storage.NewMMapWithCompletion(filepath.Join(s.dir, infoHash.HexString()), s.completion).OpenTorrent(info, infoHash)
+}
+
+func (s *mmapStorage) Close() error {
+	return s.completion.Close()
+}
+
+type pieceKey struct {
+	infoHash metainfo.Hash
+	index    int
+}
+
+type memoryPieceData struct {
+	key      pieceKey
+	data     []byte
+	complete bool
+	element  *list.Element
+}
+
+type memoryStorage struct {
+	capacity     int64
+	capacityFunc func() (int64, bool)
+
+	lock   sync.Mutex
+	pieces map[pieceKey]*memoryPieceData
+	lru    *list.List
+	size   int64
+}
+
+func newMemoryStorage(capacity int64) *memoryStorage {
+	s := &memoryStorage{
+		capacity: capacity,
+
+		pieces: map[pieceKey]*memoryPieceData{},
+		lru:    list.New(),
+	}
+
+	s.capacityFunc = func() (int64, bool) {
+		return s.capacity, true
+	}
+
+	return s
+}
+
+func (s *memoryStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	return storage.TorrentImpl{
+		Piece: func(p metainfo.Piece) storage.PieceImpl {
+			return &memoryPiece{
+				storage: s,
+				key: pieceKey{
+					infoHash: infoHash,
+					index:    p.Index(),
+				},
+				length: p.Length(),
+			}
+		},
+		Close: func() error {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			for key, piece := range s.pieces {
+				if key.infoHash == infoHash {
+					s.remove(piece)
+				}
+			}
+
+			return nil
+		},
+		Capacity: &s.capacityFunc,
+	}, nil
+}
+
+func (s *memoryStorage) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pieces = map[pieceKey]*memoryPieceData{}
+	s.lru.Init()
+	s.size = 0
+
+	return nil
+}
+
+func (s *memoryStorage) remove(piece *memoryPieceData) {
+	s.lru.Remove(piece.element)
+	delete(s.pieces, piece.key)
+	s.size -= int64(len(piece.data))
+}
+
+func (s *memoryStorage) evict(keep pieceKey) {
+	for e := s.lru.Back(); e != nil && s.size > s.capacity; {
+		prev := e.Prev()
+
+		if piece := e.Value.(*memoryPieceData); piece.complete && piece.key != keep {
+			s.remove(piece)
+		}
+
+		e = prev
+	}
+}
+
+type memoryPiece struct {
+	storage *memoryStorage
+	key     pieceKey
+	length  int64
+}
+
+func (p *memoryPiece) ReadAt(b []byte, off int64) (int, error) {
+	p.storage.lock.Lock()
+	defer p.storage.lock.Unlock()
+
+	piece, ok := p.storage.pieces[p.key]
+	if !ok {
+		return 0, ErrPieceEvicted
+	}
+	p.storage.lru.MoveToFront(piece.element)
+
+	if off >= int64(len(piece.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, piece.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (p *memoryPiece) WriteAt(b []byte, off int64) (int, error) {
+	p.storage.lock.Lock()
+	defer p.storage.lock.Unlock()
+
+	piece, ok := p.storage.pieces[p.key]
+	if !ok {
+		piece = &memoryPieceData{
+			key:  p.key,
+			data: make([]byte, p.length),
+		}
+		piece.element = p.storage.lru.PushFront(piece)
+
+		p.storage.pieces[p.key] = piece
+		p.storage.size += p.length
+
+		p.storage.evict(p.key)
+	} else {
+		p.storage.lru.MoveToFront(piece.element)
+	}
+
+	if off >= int64(len(piece.data)) {
+		return 0, io.ErrShortWrite
+	}
+
+	n := copy(piece.data[off:], b)
+	if n < len(b) {
+		return n, io.ErrShortWrite
+	}
+
+	return n, nil
+}
+
+func (p *memoryPiece) MarkComplete() error {
+	return p.setComplete(true)
+}
+
+func (p *memoryPiece) MarkNotComplete() error {
+	return p.setComplete(false)
+}
+
+func (p *memoryPiece) setComplete(complete bool) error {
+	p.storage.lock.Lock()
+	defer p.storage.lock.Unlock()
+
+	piece, ok := p.storage.pieces[p.key]
+	if !ok {
+		if complete {
+			return ErrPieceEvicted
+		}
+
+		return nil
+	}
+
+	piece.complete = complete
+	if complete {
+		p.storage.evict(p.key)
+	}
+
+	return nil
+}
+
+func (p *memoryPiece) Completion() storage.Completion {
+	p.storage.lock.Lock()
+	defer p.storage.lock.Unlock()
+
+	piece, ok := p.storage.pieces[p.key]
+
+	return storage.Completion{
+		Complete: ok && piece.complete,
+		Ok:       true,
+	}
+}
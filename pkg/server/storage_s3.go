@@ -0,0 +1,558 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	s3ListInterval = time.Second * 30
+	s3Timeout      = time.Minute
+	s3PartSuffix   = ".part"
+)
+
+var (
+	ErrMissingS3Endpoint = errors.New("missing S3 endpoint")
+	ErrMissingS3Bucket   = errors.New("missing S3 bucket")
+)
+
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	Insecure  bool
+}
+
+type s3CachedPiece struct {
+	key      pieceKey
+	size     int64
+	complete bool
+	element  *list.Element
+}
+
+type s3Torrent struct {
+	infoHash metainfo.Hash
+	dir      string
+
+	pieceLocks []sync.Mutex
+
+	lock     sync.Mutex
+	uploaded map[int]bool
+	rejected map[int]string
+
+	done chan struct{}
+}
+
+type s3Storage struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	dir      string
+	capacity int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	cached   map[pieceKey]*s3CachedPiece
+	lru      *list.List
+	size     int64
+	torrents map[metainfo.Hash]*s3Torrent
+}
+
+func newS3Storage(config S3, dir string, capacity int64) (*s3Storage, error) {
+	if strings.TrimSpace(config.Endpoint) == "" {
+		return nil, ErrMissingS3Endpoint
+	}
+
+	if strings.TrimSpace(config.Bucket) == "" {
+		return nil, ErrMissingS3Bucket
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{
+			Region: config.Region,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &s3Storage{
+		client:   client,
+		bucket:   config.Bucket,
+		prefix:   strings.Trim(config.Prefix, "/"),
+		dir:      dir,
+		capacity: capacity,
+
+		cached:   map[pieceKey]*s3CachedPiece{},
+		lru:      list.New(),
+		torrents: map[metainfo.Hash]*s3Torrent{},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if err := s.loadCache(); err != nil {
+		s.cancel()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *s3Storage) loadCache() error {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		var infoHash metainfo.Hash
+		if !dir.IsDir() || infoHash.FromHexString(dir.Name()) != nil {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			name := filepath.Join(s.dir, dir.Name(), file.Name())
+
+			index, err := strconv.Atoi(file.Name())
+			if err != nil {
+				if err := os.RemoveAll(name); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+
+			s.touch(pieceKey{
+				infoHash: infoHash,
+				index:    index,
+			}, info.Size(), true)
+		}
+	}
+
+	return nil
+}
+
+func (s *s3Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t := &s3Torrent{
+		infoHash: infoHash,
+		dir:      filepath.Join(s.dir, infoHash.HexString()),
+
+		pieceLocks: make([]sync.Mutex, info.NumPieces()),
+
+		uploaded: map[int]bool{},
+		rejected: map[int]string{},
+
+		done: make(chan struct{}),
+	}
+
+	s.lock.Lock()
+	s.torrents[infoHash] = t
+	for key, piece := range s.cached {
+		if key.infoHash == infoHash && (key.index >= info.NumPieces() || piece.size != info.Piece(key.index).Length()) {
+			s.uncache(piece)
+		}
+	}
+	s.lock.Unlock()
+
+	if err := os.MkdirAll(t.dir, os.ModePerm); err != nil {
+		return storage.TorrentImpl{}, err
+	}
+
+	if err := s.list(t); err != nil {
+		return storage.TorrentImpl{}, err
+	}
+
+	go s.refresh(t)
+
+	return storage.TorrentImpl{
+		Piece: func(p metainfo.Piece) storage.PieceImpl {
+			return &s3Piece{
+				storage: s,
+				torrent: t,
+				index:   p.Index(),
+				length:  p.Length(),
+			}
+		},
+		Close: func() error {
+			close(t.done)
+
+			s.lock.Lock()
+			if s.torrents[infoHash] == t {
+				delete(s.torrents, infoHash)
+			}
+			s.lock.Unlock()
+
+			return nil
+		},
+	}, nil
+}
+
+func (s *s3Storage) Close() error {
+	s.cancel()
+
+	return nil
+}
+
+func (s *s3Storage) objectName(infoHash metainfo.Hash, index int) string {
+	return path.Join(s.prefix, infoHash.HexString(), strconv.Itoa(index))
+}
+
+func (s *s3Storage) refresh(t *s3Torrent) {
+	tick := time.NewTicker(s3ListInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.done:
+			return
+		case <-tick.C:
+			_ = s.list(t)
+		}
+	}
+}
+
+func (s *s3Storage) list(t *s3Torrent) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s3Timeout)
+	defer cancel()
+
+	uploaded := map[int]string{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    path.Join(s.prefix, t.infoHash.HexString()) + "/",
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+
+		index, err := strconv.Atoi(path.Base(object.Key))
+		if err != nil {
+			continue
+		}
+
+		uploaded[index] = object.ETag
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.uploaded = map[int]bool{}
+	for index, etag := range uploaded {
+		if rejected, ok := t.rejected[index]; ok {
+			if rejected == etag {
+				continue
+			}
+
+			delete(t.rejected, index)
+		}
+
+		t.uploaded[index] = true
+	}
+
+	return nil
+}
+
+func (s *s3Storage) touch(key pieceKey, size int64, complete bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	piece, ok := s.cached[key]
+	if !ok {
+		piece = &s3CachedPiece{
+			key:  key,
+			size: size,
+		}
+		piece.element = s.lru.PushFront(piece)
+
+		s.cached[key] = piece
+		s.size += size
+	} else {
+		s.lru.MoveToFront(piece.element)
+	}
+
+	if complete {
+		piece.complete = true
+	}
+
+	s.evict(key)
+}
+
+func (s *s3Storage) isCached(key pieceKey) (bool, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	piece, ok := s.cached[key]
+	if !ok {
+		return false, false
+	}
+	s.lru.MoveToFront(piece.element)
+
+	return piece.complete, true
+}
+
+func (s *s3Storage) forget(key pieceKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if piece, ok := s.cached[key]; ok {
+		s.uncache(piece)
+	}
+}
+
+func (s *s3Storage) uncache(piece *s3CachedPiece) {
+	s.lru.Remove(piece.element)
+	delete(s.cached, piece.key)
+	s.size -= piece.size
+
+	name := filepath.Join(s.dir, piece.key.infoHash.HexString(), strconv.Itoa(piece.key.index))
+
+	_ = os.Remove(name)
+	_ = os.Remove(name + s3PartSuffix)
+}
+
+func (s *s3Storage) evict(keep pieceKey) {
+	if s.capacity <= 0 {
+		return
+	}
+
+	for e := s.lru.Back(); e != nil && s.size > s.capacity; {
+		prev := e.Prev()
+
+		if piece := e.Value.(*s3CachedPiece); piece.complete && piece.key != keep {
+			if unlock, ok := s.tryLockPiece(piece.key); ok {
+				s.uncache(piece)
+				unlock()
+			}
+		}
+
+		e = prev
+	}
+}
+
+func (s *s3Storage) tryLockPiece(key pieceKey) (func(), bool) {
+	t, ok := s.torrents[key.infoHash]
+	if !ok || key.index >= len(t.pieceLocks) {
+		return func() {}, true
+	}
+
+	l := &t.pieceLocks[key.index]
+	if !l.TryLock() {
+		return nil, false
+	}
+
+	return l.Unlock, true
+}
+
+type s3Piece struct {
+	storage *s3Storage
+	torrent *s3Torrent
+	index   int
+	length  int64
+}
+
+func (p *s3Piece) key() pieceKey {
+	return pieceKey{
+		infoHash: p.torrent.infoHash,
+		index:    p.index,
+	}
+}
+
+func (p *s3Piece) path() string {
+	return filepath.Join(p.torrent.dir, strconv.Itoa(p.index))
+}
+
+func (p *s3Piece) partPath() string {
+	return p.path() + s3PartSuffix
+}
+
+func (p *s3Piece) isUploaded() bool {
+	p.torrent.lock.Lock()
+	defer p.torrent.lock.Unlock()
+
+	return p.torrent.uploaded[p.index]
+}
+
+func (p *s3Piece) setUploaded(uploaded bool) {
+	p.torrent.lock.Lock()
+	defer p.torrent.lock.Unlock()
+
+	if uploaded {
+		p.torrent.uploaded[p.index] = true
+		delete(p.torrent.rejected, p.index)
+	} else {
+		delete(p.torrent.uploaded, p.index)
+	}
+}
+
+func (p *s3Piece) reject(etag string) {
+	p.torrent.lock.Lock()
+	defer p.torrent.lock.Unlock()
+
+	delete(p.torrent.uploaded, p.index)
+	p.torrent.rejected[p.index] = etag
+}
+
+func (p *s3Piece) ReadAt(b []byte, off int64) (int, error) {
+	p.torrent.pieceLocks[p.index].Lock()
+	defer p.torrent.pieceLocks[p.index].Unlock()
+
+	name := p.path()
+
+	complete, cached := p.storage.isCached(p.key())
+	if !cached || (!complete && p.isUploaded()) {
+		ctx, cancel := context.WithTimeout(p.storage.ctx, s3Timeout)
+		defer cancel()
+
+		if err := p.storage.client.FGetObject(
+			ctx,
+			p.storage.bucket,
+			p.storage.objectName(p.torrent.infoHash, p.index),
+			p.path(),
+			minio.GetObjectOptions{},
+		); err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				p.setUploaded(false)
+			}
+
+			return 0, err
+		}
+
+		p.storage.touch(p.key(), p.length, true)
+	} else if !complete {
+		name = p.partPath()
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.ReadAt(b, off)
+}
+
+func (p *s3Piece) WriteAt(b []byte, off int64) (int, error) {
+	p.torrent.pieceLocks[p.index].Lock()
+	defer p.torrent.pieceLocks[p.index].Unlock()
+
+	f, err := os.OpenFile(p.partPath(), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	p.storage.touch(p.key(), p.length, false)
+
+	return f.WriteAt(b, off)
+}
+
+func (p *s3Piece) MarkComplete() error {
+	p.torrent.pieceLocks[p.index].Lock()
+	defer p.torrent.pieceLocks[p.index].Unlock()
+
+	if err := os.Rename(p.partPath(), p.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	p.storage.touch(p.key(), p.length, true)
+
+	ctx, cancel := context.WithTimeout(p.storage.ctx, s3Timeout)
+	defer cancel()
+
+	if _, err := p.storage.client.FPutObject(
+		ctx,
+		p.storage.bucket,
+		p.storage.objectName(p.torrent.infoHash, p.index),
+		p.path(),
+		minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+		},
+	); err != nil {
+		return err
+	}
+
+	p.setUploaded(true)
+
+	return nil
+}
+
+func (p *s3Piece) MarkNotComplete() error {
+	p.torrent.pieceLocks[p.index].Lock()
+	defer p.torrent.pieceLocks[p.index].Unlock()
+
+	p.setUploaded(false)
+	p.storage.forget(p.key())
+
+	ctx, cancel := context.WithTimeout(p.storage.ctx, s3Timeout)
+	defer cancel()
+
+	object, err := p.storage.client.StatObject(
+		ctx,
+		p.storage.bucket,
+		p.storage.objectName(p.torrent.infoHash, p.index),
+		minio.StatObjectOptions{},
+	)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil
+		}
+
+		return err
+	}
+
+	p.reject(object.ETag)
+
+	return nil
+}
+
+func (p *s3Piece) Completion() storage.Completion {
+	return storage.Completion{
+		Complete: p.isUploaded(),
+		Ok:       true,
+	}
+}
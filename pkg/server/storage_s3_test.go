@@ -0,0 +1,483 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, S3) {
+	f := &fakeS3{
+		objects: map[string][]byte{},
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, S3{
+		Endpoint:  u.Host,
+		Bucket:    "htorrent",
+		Prefix:    "pieces",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+		Insecure:  true,
+	}
+}
+
+type fakeS3Object struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	ETag         string `xml:"ETag"`
+	LastModified string `xml:"LastModified"`
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name       `xml:"ListBucketResult"`
+	Name        string         `xml:"Name"`
+	Prefix      string         `xml:"Prefix"`
+	KeyCount    int            `xml:"KeyCount"`
+	MaxKeys     int            `xml:"MaxKeys"`
+	IsTruncated bool           `xml:"IsTruncated"`
+	Contents    []fakeS3Object `xml:"Contents"`
+}
+
+type fakeS3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead, http.MethodPut:
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			prefix := r.URL.Query().Get("prefix")
+
+			res := fakeS3ListResult{
+				Name:    bucket,
+				Prefix:  prefix,
+				MaxKeys: 1000,
+			}
+
+			keys := []string{}
+			for k := range f.objects {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				res.Contents = append(res.Contents, fakeS3Object{
+					Key:          k,
+					Size:         int64(len(f.objects[k])),
+					ETag:         `"etag"`,
+					LastModified: time.Now().UTC().Format(time.RFC3339),
+				})
+			}
+			res.KeyCount = len(res.Contents)
+
+			w.Header().Set("Content-Type", "application/xml")
+			_ = xml.NewEncoder(w).Encode(res)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(r.Body)
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		f.objects[key] = data
+
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead, http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_ = xml.NewEncoder(w).Encode(fakeS3Error{Code: "NoSuchKey"})
+			}
+
+			return
+		}
+
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method == http.MethodGet {
+			f.gets++
+
+			_, _ = w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func decodeAWSChunked(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	out := &bytes.Buffer{}
+
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return out
+		}
+
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil || size == 0 {
+			return out
+		}
+
+		if _, err := io.CopyN(out, br, size); err != nil {
+			return out
+		}
+
+		if _, err := br.Discard(2); err != nil {
+			return out
+		}
+	}
+}
+
+func (f *fakeS3) getCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.gets
+}
+
+func (f *fakeS3) objectCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.objects)
+}
+
+func getS3Torrent(s *s3Storage, infoHash metainfo.Hash) *s3Torrent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.torrents[infoHash]
+}
+
+func newTestInfo() (*metainfo.Info, metainfo.Hash) {
+	info := &metainfo.Info{
+		Name:        "test.bin",
+		PieceLength: 16,
+		Length:      40,
+		Pieces:      make([]byte, 3*20),
+	}
+
+	return info, metainfo.HashBytes([]byte("test"))
+}
+
+func writePiece(t *testing.T, tor storage.TorrentImpl, info *metainfo.Info, index int) []byte {
+	p := info.Piece(index)
+	data := bytes.Repeat([]byte{byte('a' + index)}, int(p.Length()))
+
+	piece := tor.Piece(p)
+	if _, err := piece.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := piece.MarkComplete(); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func readPiece(t *testing.T, tor storage.TorrentImpl, info *metainfo.Info, index int) []byte {
+	p := info.Piece(index)
+
+	data := make([]byte, p.Length())
+	if _, err := tor.Piece(p).ReadAt(data, 0); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestS3StorageSharesPiecesThroughBucket(t *testing.T) {
+	fake, config := newFakeS3(t)
+	info, infoHash := newTestInfo()
+
+	a, err := newS3Storage(config, t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	ta, err := a.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ta.Close()
+
+	want := map[int][]byte{}
+	for i := 0; i < info.NumPieces(); i++ {
+		want[i] = writePiece(t, ta, info, i)
+	}
+
+	if got := fake.objectCount(); got != info.NumPieces() {
+		t.Fatalf("expected %v objects in bucket, got %v", info.NumPieces(), got)
+	}
+
+	b, err := newS3Storage(config, t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	tb, err := b.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	for i := 0; i < info.NumPieces(); i++ {
+		if c := tb.Piece(info.Piece(i)).Completion(); !c.Ok || !c.Complete {
+			t.Fatalf("expected piece %v to be complete, got %+v", i, c)
+		}
+
+		if got := readPiece(t, tb, info, i); !bytes.Equal(got, want[i]) {
+			t.Fatalf("piece %v: expected %q, got %q", i, want[i], got)
+		}
+	}
+
+	if got := fake.getCount(); got != info.NumPieces() {
+		t.Fatalf("expected %v downloads, got %v", info.NumPieces(), got)
+	}
+
+	if err := tb.Piece(info.Piece(0)).MarkNotComplete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := tb.Piece(info.Piece(0)).Completion(); c.Complete {
+		t.Fatal("expected piece 0 to be incomplete after marking it as such")
+	}
+
+	if got := fake.objectCount(); got != info.NumPieces() {
+		t.Fatalf("expected marking a piece as incomplete to keep it in the bucket, got %v objects", got)
+	}
+
+	if err := b.list(getS3Torrent(b, infoHash)); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := tb.Piece(info.Piece(0)).Completion(); c.Complete {
+		t.Fatal("expected rejected piece 0 to stay incomplete after listing the bucket")
+	}
+
+	if c := ta.Piece(info.Piece(0)).Completion(); !c.Complete {
+		t.Fatal("expected piece 0 to stay complete for the other replica")
+	}
+
+	if got := readPiece(t, ta, info, 0); !bytes.Equal(got, want[0]) {
+		t.Fatalf("expected %q, got %q", want[0], got)
+	}
+
+	writePiece(t, tb, info, 0)
+
+	if c := tb.Piece(info.Piece(0)).Completion(); !c.Complete {
+		t.Fatal("expected piece 0 to be complete after writing it again")
+	}
+}
+
+func TestS3StorageKeepsVerifiedCacheAcrossRestarts(t *testing.T) {
+	fake, config := newFakeS3(t)
+	info, infoHash := newTestInfo()
+	dir := t.TempDir()
+
+	a, err := newS3Storage(config, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ta, err := a.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := writePiece(t, ta, info, 0)
+
+	partial := info.Piece(1)
+	if _, err := ta.Piece(partial).WriteAt([]byte("partial"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ta.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newS3Storage(config, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	tb, err := b.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	if got := readPiece(t, tb, info, 0); !bytes.Equal(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got := fake.getCount(); got != 0 {
+		t.Fatalf("expected cached piece to be read without downloading it, got %v downloads", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, infoHash.HexString(), fmt.Sprintf("%v%v", partial.Index(), s3PartSuffix))); !os.IsNotExist(err) {
+		t.Fatalf("expected partial piece to be discarded, got %v", err)
+	}
+
+	if c := tb.Piece(partial).Completion(); c.Complete {
+		t.Fatal("expected partial piece to be incomplete")
+	}
+}
+
+func TestS3StorageEvictsCacheToCapacity(t *testing.T) {
+	_, config := newFakeS3(t)
+	info, infoHash := newTestInfo()
+	dir := t.TempDir()
+
+	s, err := newS3Storage(config, dir, info.PieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tor, err := s.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tor.Close()
+
+	for i := 0; i < info.NumPieces(); i++ {
+		writePiece(t, tor, info, i)
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, infoHash.HexString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected one cached piece, got %v", len(files))
+	}
+
+	for i := 0; i < info.NumPieces(); i++ {
+		if c := tor.Piece(info.Piece(i)).Completion(); !c.Complete {
+			t.Fatalf("expected evicted piece %v to remain complete in bucket", i)
+		}
+	}
+}
+
+func TestS3StorageSkipsLockedPiecesWhenEvicting(t *testing.T) {
+	_, config := newFakeS3(t)
+	info, infoHash := newTestInfo()
+	dir := t.TempDir()
+
+	s, err := newS3Storage(config, dir, info.PieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tor, err := s.OpenTorrent(info, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tor.Close()
+
+	want := writePiece(t, tor, info, 0)
+
+	pieceLock := &getS3Torrent(s, infoHash).pieceLocks[0]
+
+	pieceLock.Lock()
+	writePiece(t, tor, info, 1)
+	pieceLock.Unlock()
+
+	got, err := os.ReadFile(filepath.Join(dir, infoHash.HexString(), "0"))
+	if err != nil {
+		t.Fatalf("expected locked piece to stay cached, got %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	writePiece(t, tor, info, 2)
+
+	if _, err := os.Stat(filepath.Join(dir, infoHash.HexString(), "0")); !os.IsNotExist(err) {
+		t.Fatalf("expected unlocked piece to be evicted, got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build cgo
+
+package server
+
+import (
+	"github.com/anacrolix/squirrel"
+	"github.com/anacrolix/torrent/storage"
+	sqliteStorage "github.com/anacrolix/torrent/storage/sqlite"
+)
+
+func newSQLiteStorage(path string, capacity int64) (storage.ClientImplCloser, error) {
+	if capacity <= 0 {
+		capacity = -1
+	}
+
+	return sqliteStorage.NewDirectStorage(sqliteStorage.NewDirectStorageOpts{
+		NewConnOpts: squirrel.NewConnOpts{
+			Path: path,
+		},
+		InitDbOpts: squirrel.InitDbOpts{
+			Capacity: capacity,
+		},
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package server
+
+import (
+	"errors"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+var (
+	ErrSQLiteStorageUnsupported = errors.New("SQLite storage backend is not supported in builds without cgo")
+)
+
+func newSQLiteStorage(path string, capacity int64) (storage.ClientImplCloser, error) {
+	return nil, ErrSQLiteStorageUnsupported
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	streamIDLen = 8
+)
+
+var (
+	ErrUnknownStream = errors.New("unknown stream")
+	ErrEmptyStreamID = errors.New("stream ID is empty")
+)
+
+type activeStream struct {
+	id         string
+	principal  string
+	remoteAddr string
+	infoHash   metainfo.Hash
+	index      int
+	path       string
+	length     int64
+	started    time.Time
+	cancel     func()
+
+	offset  int64
+	written int64
+	sent    rateCounter
+}
+
+type streamResponseWriter struct {
+	http.ResponseWriter
+
+	g      *Gateway
+	stream *activeStream
+}
+
+func (w *streamResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+
+	w.g.streamsLock.Lock()
+	w.stream.written += int64(n)
+	w.stream.sent.add(time.Now(), int64(n))
+	w.g.streamsLock.Unlock()
+
+	return n, err
+}
+
+func (w *streamResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type streamReader struct {
+	io.ReadSeekCloser
+
+	ctx    context.Context
+	g      *Gateway
+	stream *activeStream
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.ReadSeekCloser.Read(p)
+
+	r.g.streamsLock.Lock()
+	r.stream.offset += int64(n)
+	r.g.streamsLock.Unlock()
+
+	return n, err
+}
+
+func (r *streamReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeekCloser.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+
+	r.g.streamsLock.Lock()
+	r.stream.offset = pos
+	r.g.streamsLock.Unlock()
+
+	return pos, nil
+}
+
+func newStreamID() (string, error) {
+	id := make([]byte, streamIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+func (g *Gateway) addStream(stream *activeStream) func() {
+	g.streamsLock.Lock()
+	defer g.streamsLock.Unlock()
+
+	g.streams[stream.id] = stream
+
+	return func() {
+		g.streamsLock.Lock()
+		defer g.streamsLock.Unlock()
+
+		delete(g.streams, stream.id)
+	}
+}
+
+func (g *Gateway) cancelStream(id string) (*activeStream, bool) {
+	g.streamsLock.Lock()
+	defer g.streamsLock.Unlock()
+
+	stream, ok := g.streams[id]
+	if !ok {
+		return nil, false
+	}
+
+	stream.cancel()
+
+	return stream, true
+}
+
+func (g *Gateway) getStreamMetrics() []v1.StreamMetrics {
+	g.streamsLock.Lock()
+	defer g.streamsLock.Unlock()
+
+	now := time.Now()
+
+	metrics := []v1.StreamMetrics{}
+	for _, stream := range g.streams {
+		metrics = append(metrics, v1.StreamMetrics{
+			ID:         stream.id,
+			Principal:  stream.principal,
+			RemoteAddr: stream.remoteAddr,
+			InfoHash:   stream.infoHash.HexString(),
+			Index:      stream.index,
+			Path:       stream.path,
+			Length:     stream.length,
+			Offset:     stream.offset,
+			Sent:       stream.written,
+			EgressRate: stream.sent.rate(now),
+			Started:    stream.started.Unix(),
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Started == metrics[j].Started {
+			return metrics[i].ID < metrics[j].ID
+		}
+
+		return metrics[i].Started < metrics[j].Started
+	})
+
+	return metrics
+}
+
+func (g *Gateway) getTorrentStreamMetrics(infoHash metainfo.Hash) []v1.StreamMetrics {
+	metrics := []v1.StreamMetrics{}
+	for _, stream := range g.getStreamMetrics() {
+		if stream.InfoHash == infoHash.HexString() {
+			metrics = append(metrics, stream)
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequired = "required"
+
+	certificateCheckInterval = time.Second * 10
+)
+
+var (
+	ErrMissingTLSKey          = errors.New("missing TLS key")
+	ErrMissingTLSCert         = errors.New("missing TLS certificate")
+	ErrUnknownClientAuth      = errors.New("unknown client auth mode")
+	ErrMissingClientCA        = errors.New("missing client CA for client auth")
+	ErrCouldNotParseClientCA  = errors.New("could not parse client CA")
+	ErrConflictingTLSSettings = errors.New("could not use both a TLS certificate and ACME")
+)
+
+type TLS struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   string
+	ACMEDomains  []string
+	ACMEEmail    string
+	ACMECacheDir string
+}
+
+func (t TLS) Enabled() bool {
+	return strings.TrimSpace(t.CertFile) != "" || strings.TrimSpace(t.KeyFile) != "" || len(t.ACMEDomains) > 0
+}
+
+func (t TLS) getConfig(log zerolog.Logger) (*tls.Config, error) {
+	var cfg *tls.Config
+	if len(t.ACMEDomains) > 0 {
+		if strings.TrimSpace(t.CertFile) != "" || strings.TrimSpace(t.KeyFile) != "" {
+			return nil, ErrConflictingTLSSettings
+		}
+
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(t.ACMEDomains...),
+			Email:      t.ACMEEmail,
+		}
+
+		if strings.TrimSpace(t.ACMECacheDir) != "" {
+			m.Cache = autocert.DirCache(t.ACMECacheDir)
+		}
+
+		cfg = m.TLSConfig()
+	} else {
+		if strings.TrimSpace(t.CertFile) == "" {
+			return nil, ErrMissingTLSCert
+		}
+
+		if strings.TrimSpace(t.KeyFile) == "" {
+			return nil, ErrMissingTLSKey
+		}
+
+		loader := &certificateLoader{
+			certFile: t.CertFile,
+			keyFile:  t.KeyFile,
+			log:      log,
+		}
+
+		if err := loader.load(); err != nil {
+			return nil, err
+		}
+
+		cfg = &tls.Config{
+			GetCertificate: loader.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+
+	cfg.MinVersion = tls.VersionTLS12
+
+	switch t.ClientAuth {
+	case "", ClientAuthNone:
+		return cfg, nil
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownClientAuth, t.ClientAuth)
+	}
+
+	if strings.TrimSpace(t.ClientCAFile) == "" {
+		return nil, ErrMissingClientCA
+	}
+
+	ca, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(ca) {
+		return nil, ErrCouldNotParseClientCA
+	}
+
+	return cfg, nil
+}
+
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+	log      zerolog.Logger
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	lastCheck   time.Time
+}
+
+func (c *certificateLoader) getModTime() (time.Time, error) {
+	certStat, err := os.Stat(c.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyStat, err := os.Stat(c.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyStat.ModTime().After(certStat.ModTime()) {
+		return keyStat.ModTime(), nil
+	}
+
+	return certStat.ModTime(), nil
+}
+
+func (c *certificateLoader) load() error {
+	modTime, err := c.getModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.certificate = &certificate
+	c.modTime = modTime
+	c.lastCheck = time.Now()
+
+	return nil
+}
+
+func (c *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if time.Since(c.lastCheck) < certificateCheckInterval {
+		return c.certificate, nil
+	}
+	c.lastCheck = time.Now()
+
+	modTime, err := c.getModTime()
+	if err != nil {
+		c.log.Error().
+			Err(err).
+			Msg("Could not check TLS certificate for changes, continuing with previous one")
+
+		return c.certificate, nil
+	}
+
+	if !modTime.After(c.modTime) {
+		return c.certificate, nil
+	}
+
+	c.log.Info().Msg("Reloading TLS certificate")
+
+	if err := c.load(); err != nil {
+		c.log.Error().
+			Err(err).
+			Msg("Could not reload TLS certificate, continuing with previous one")
+	}
+
+	return c.certificate, nil
+}
+
+func getClientCertificatePrincipal(r *http.Request, roles map[string]Role, defaultRole Role) (Principal, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Principal{}, false
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if strings.TrimSpace(name) == "" {
+		return Principal{}, false
+	}
+
+	role, ok := roles[name]
+	if !ok {
+		role = defaultRole
+	}
+
+	return Principal{
+		Name: name,
+		Role: role,
+	}, true
+}
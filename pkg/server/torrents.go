@@ -0,0 +1,322 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types"
+)
+
+const (
+	PriorityNone   = "none"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+var (
+	ErrUnknownPriority = errors.New("unknown priority")
+)
+
+func ParsePriority(priority string) (types.PiecePriority, error) {
+	switch strings.TrimSpace(priority) {
+	case PriorityNone:
+		return types.PiecePriorityNone, nil
+	case PriorityNormal:
+		return types.PiecePriorityNormal, nil
+	case PriorityHigh:
+		return types.PiecePriorityHigh, nil
+	default:
+		return types.PiecePriorityNone, fmt.Errorf("%w: %v", ErrUnknownPriority, priority)
+	}
+}
+
+func formatPriority(priority types.PiecePriority) string {
+	switch priority {
+	case types.PiecePriorityNone:
+		return PriorityNone
+	case types.PiecePriorityNormal:
+		return PriorityNormal
+	default:
+		return PriorityHigh
+	}
+}
+
+func (g *Gateway) isPaused(infoHash metainfo.Hash) bool {
+	g.pausedLock.Lock()
+	defer g.pausedLock.Unlock()
+
+	return g.paused[infoHash]
+}
+
+func (g *Gateway) setPaused(t *torrent.Torrent, paused bool) error {
+	g.pausedLock.Lock()
+	if paused {
+		g.paused[t.InfoHash()] = true
+	} else {
+		delete(g.paused, t.InfoHash())
+	}
+	g.pausedLock.Unlock()
+
+	g.updateDownload(t)
+	g.updateUpload(t)
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.Paused = paused
+	})
+}
+
+func (g *Gateway) updateDownload(t *torrent.Torrent) {
+	throttled, _ := g.isThrottled(t.InfoHash())
+
+	if throttled || g.isPaused(t.InfoHash()) {
+		t.DisallowDataDownload()
+	} else {
+		t.AllowDataDownload()
+	}
+}
+
+func (g *Gateway) updateUpload(t *torrent.Torrent) {
+	_, throttled := g.isThrottled(t.InfoHash())
+
+	if throttled || g.isSeedingDone(t.InfoHash()) || g.isPaused(t.InfoHash()) {
+		t.DisallowDataUpload()
+	} else {
+		t.AllowDataUpload()
+	}
+}
+
+func (g *Gateway) setPriority(t *torrent.Torrent, index int, priority types.PiecePriority) error {
+	t.Files()[index].SetPriority(priority)
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		if st.Priorities == nil {
+			st.Priorities = map[int]string{}
+		}
+
+		st.Priorities[index] = formatPriority(priority)
+	})
+}
+
+func (g *Gateway) persistTorrent(t *torrent.Torrent, magnetLink string) error {
+	if g.session == nil {
+		return nil
+	}
+
+	var (
+		mi  []byte
+		err error
+	)
+	if t.Info() != nil {
+		mi, err = encodeMetainfo(t.Metainfo())
+		if err != nil {
+			return err
+		}
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		st.Magnet = magnetLink
+		if mi != nil {
+			st.Metainfo = mi
+		}
+	})
+}
+
+func (g *Gateway) mergeTorrent(t *torrent.Torrent) (*torrent.Torrent, error) {
+	g.mergeLock.Lock()
+	defer g.mergeLock.Unlock()
+
+	select {
+	case <-t.Closed():
+		if merged, ok := g.torrentClient.Torrent(t.InfoHash()); ok {
+			return merged, nil
+		}
+
+		return t, nil
+	default:
+	}
+
+	duplicates := []*torrent.Torrent{}
+	for _, o := range g.torrentClient.Torrents() {
+		if o != t && o.Info() != nil && o.InfoHash() == t.InfoHash() {
+			duplicates = append(duplicates, o)
+		}
+	}
+
+	if len(duplicates) == 0 {
+		return t, nil
+	}
+
+	mi := t.Metainfo()
+	peers := t.KnownSwarm()
+	for _, o := range duplicates {
+		peers = append(peers, o.KnownSwarm()...)
+
+		o.Drop()
+	}
+	t.Drop()
+
+	g.log.Debug().
+		Str("infohash", t.InfoHash().HexString()).
+		Int("duplicates", len(duplicates)).
+		Msg("Merging torrents added by v1 and v2 infohash")
+
+	merged, err := g.addMetainfo(&mi)
+	if err != nil {
+		return nil, err
+	}
+
+	merged.AddPeers(peers)
+	g.network.addTrackers(merged)
+
+	return merged, nil
+}
+
+func (g *Gateway) rekeyTorrent(infoHash metainfo.Hash, t *torrent.Torrent) error {
+	if g.session == nil || infoHash == t.InfoHash() {
+		return nil
+	}
+
+	return g.session.remove(infoHash)
+}
+
+func (g *Gateway) forgetTorrent(infoHash metainfo.Hash) error {
+	g.pausedLock.Lock()
+	delete(g.paused, infoHash)
+	g.pausedLock.Unlock()
+
+	g.forgetSeeding(infoHash)
+	g.forgetTorrentBandwidth(infoHash)
+	g.forgetSources(infoHash)
+	g.forgetTrackers(infoHash)
+	g.forgetRates(infoHash)
+	g.forgetSelection(infoHash)
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.remove(infoHash)
+}
+
+func (g *Gateway) restoreTorrents() error {
+	torrents, err := g.session.list()
+	if err != nil {
+		return err
+	}
+
+	for infoHash, st := range torrents {
+		var t *torrent.Torrent
+		if st.SeedPath != "" {
+			mi, err := decodeMetainfo(st.Metainfo)
+			if err != nil {
+				return err
+			}
+
+			t, err = g.seedTorrent(mi, st.SeedPath)
+			if err != nil {
+				return err
+			}
+		} else if len(st.Metainfo) > 0 {
+			mi, err := decodeMetainfo(st.Metainfo)
+			if err != nil {
+				return err
+			}
+
+			t, err = g.addMetainfo(mi)
+			if err != nil {
+				return err
+			}
+		} else {
+			t, err = g.addMagnet(st.Magnet)
+			if err != nil {
+				return err
+			}
+		}
+
+		g.network.addTrackers(t)
+		t.AddWebSeeds(st.WebSeeds)
+
+		g.log.Debug().
+			Str("infohash", infoHash.HexString()).
+			Bool("paused", st.Paused).
+			Msg("Restored torrent")
+
+		if st.Paused {
+			g.pausedLock.Lock()
+			g.paused[infoHash] = true
+			g.pausedLock.Unlock()
+
+			t.DisallowDataDownload()
+			t.DisallowDataUpload()
+		}
+
+		if err := g.restoreSeeding(infoHash, st); err != nil {
+			return err
+		}
+
+		g.restoreTorrentBandwidth(infoHash, st.DownloadRate, st.UploadRate)
+
+		if err := g.restoreSelection(infoHash, st.SelectOnly); err != nil {
+			return err
+		}
+
+		go func(t *torrent.Torrent, st sessionTorrent) {
+			select {
+			case <-g.ctx.Done():
+				return
+			case <-t.Closed():
+				return
+			case <-t.GotInfo():
+			}
+
+			if len(st.Metainfo) == 0 {
+				if err := g.persistTorrent(t, st.Magnet); err != nil {
+					g.log.Error().
+						Err(err).
+						Str("infohash", t.InfoHash().HexString()).
+						Msg("Could not persist torrent")
+				}
+			}
+
+			for i, f := range t.Files() {
+				rawPriority, ok := st.Priorities[i]
+				if !ok {
+					continue
+				}
+
+				priority, err := ParsePriority(rawPriority)
+				if err != nil {
+					g.log.Error().
+						Err(err).
+						Str("infohash", t.InfoHash().HexString()).
+						Str("path", f.Path()).
+						Msg("Could not restore priority")
+
+					continue
+				}
+
+				f.SetPriority(priority)
+			}
+
+			if err := g.checkSeeding(t); err != nil {
+				g.log.Error().
+					Err(err).
+					Str("infohash", t.InfoHash().HexString()).
+					Msg("Could not check seeding state")
+			}
+		}(t, st)
+	}
+
+	return nil
+}
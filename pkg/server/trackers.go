@@ -0,0 +1,322 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+	trHttp "github.com/anacrolix/torrent/tracker/http"
+	"github.com/anacrolix/torrent/tracker/udp"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	trackerStatusInterval = 10 * time.Second
+	trackerScrapeInterval = time.Minute
+	trackerScrapeTimeout  = 10 * time.Second
+)
+
+var (
+	ErrEmptyScrape = errors.New("tracker did not return a scrape result for the torrent")
+)
+
+type trackerAnnounce struct {
+	next  time.Time
+	done  bool
+	peers int
+	err   string
+}
+
+func (a trackerAnnounce) changed(o trackerAnnounce) bool {
+	return a.done != o.done || a.peers != o.peers || a.err != o.err || a.next.Sub(o.next).Abs() > trackerStatusInterval
+}
+
+type trackerStatus struct {
+	announce  trackerAnnounce
+	announced time.Time
+	scrape    udp.ScrapeInfohashResult
+	scrapeErr error
+	scraped   time.Time
+}
+
+func getTrackers(t *torrent.Torrent) []string {
+	mi := t.Metainfo()
+
+	trackers := []string{}
+	seen := map[string]struct{}{}
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, trackerURL := range tier {
+			if _, ok := seen[trackerURL]; ok {
+				continue
+			}
+			seen[trackerURL] = struct{}{}
+
+			trackers = append(trackers, trackerURL)
+		}
+	}
+
+	return trackers
+}
+
+func getTrackerClientOpts(cfg *torrent.ClientConfig) tracker.NewClientOpts {
+	return tracker.NewClientOpts{
+		Http: trHttp.NewClientOpts{
+			Proxy:       cfg.HTTPProxy,
+			DialContext: cfg.TrackerDialContext,
+		},
+		ListenPacket: cfg.TrackerListenPacket,
+	}
+}
+
+func scrapeTracker(ctx context.Context, opts tracker.NewClientOpts, trackerURL string, infoHash metainfo.Hash) (udp.ScrapeInfohashResult, error) {
+	u, err := url.Parse(trackerURL)
+	if err != nil {
+		return udp.ScrapeInfohashResult{}, err
+	}
+	opts.Http.ServerName = u.Hostname()
+
+	c, err := tracker.NewClient(trackerURL, opts)
+	if err != nil {
+		return udp.ScrapeInfohashResult{}, err
+	}
+	defer c.Close()
+
+	res, err := c.Scrape(ctx, []metainfo.Hash{infoHash})
+	if err != nil {
+		return udp.ScrapeInfohashResult{}, err
+	}
+
+	if len(res) == 0 {
+		return udp.ScrapeInfohashResult{}, ErrEmptyScrape
+	}
+
+	return res[0], nil
+}
+
+func parseTrackerAnnounce(rawStatus string, now time.Time) (trackerAnnounce, bool) {
+	rawNext, rawLast, ok := strings.Cut(rawStatus, ", last ann: ")
+	if !ok {
+		return trackerAnnounce{}, false
+	}
+
+	announce := trackerAnnounce{}
+	if rawNext = strings.TrimPrefix(rawNext, "next ann: "); rawNext != "anytime" {
+		next, err := time.ParseDuration(rawNext)
+		if err != nil {
+			return trackerAnnounce{}, false
+		}
+
+		announce.next = now.Add(next)
+	}
+
+	if rawLast == "never" {
+		return announce, true
+	}
+	announce.done = true
+
+	if rawPeers, ok := strings.CutSuffix(rawLast, " peers"); ok {
+		if peers, err := strconv.Atoi(rawPeers); err == nil {
+			announce.peers = peers
+
+			return announce, true
+		}
+	}
+	announce.err = rawLast
+
+	return announce, true
+}
+
+func parseTrackerAnnounces(rawStatus string, now time.Time) map[metainfo.Hash]map[string]trackerAnnounce {
+	announces := map[metainfo.Hash]map[string]trackerAnnounce{}
+
+	var current map[string]trackerAnnounce
+	inTrackers := false
+	for _, line := range strings.Split(rawStatus, "\n") {
+		if rawInfoHash, ok := strings.CutPrefix(line, "Infohash: "); ok {
+			var infoHash metainfo.Hash
+			if err := infoHash.FromHexString(rawInfoHash); err != nil {
+				current = nil
+
+				continue
+			}
+
+			current = map[string]trackerAnnounce{}
+			announces[infoHash] = current
+
+			continue
+		}
+
+		if line == "Enabled trackers:" {
+			inTrackers = current != nil
+
+			continue
+		}
+
+		if !inTrackers || !strings.HasPrefix(line, "    ") {
+			inTrackers = false
+
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		rawURL, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			continue
+		}
+
+		trackerURL, err := strconv.Unquote(rawURL)
+		if err != nil {
+			continue
+		}
+
+		if announce, ok := parseTrackerAnnounce(strings.TrimSpace(strings.TrimPrefix(line, rawURL)), now); ok {
+			current[trackerURL] = announce
+		}
+	}
+
+	return announces
+}
+
+func (g *Gateway) monitorTrackers() {
+	tick := time.NewTicker(trackerStatusInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.closed:
+			return
+		case now := <-tick.C:
+			g.updateTrackers(now)
+		}
+	}
+}
+
+func (g *Gateway) updateTrackers(now time.Time) {
+	var rawStatus strings.Builder
+	g.torrentClient.WriteStatus(&rawStatus)
+
+	announces := parseTrackerAnnounces(rawStatus.String(), now)
+
+	ctx, cancel := context.WithTimeout(g.ctx, trackerScrapeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, t := range g.torrentClient.Torrents() {
+		infoHash := t.InfoHash()
+
+		g.trackersLock.Lock()
+		statuses := map[string]*trackerStatus{}
+		stale := map[string]*trackerStatus{}
+		for _, trackerURL := range getTrackers(t) {
+			status, ok := g.trackers[infoHash][trackerURL]
+			if !ok {
+				status = &trackerStatus{}
+			}
+
+			if announce, ok := announces[infoHash][trackerURL]; ok {
+				if announce.done && announce.changed(status.announce) {
+					status.announced = now
+				}
+
+				status.announce = announce
+			}
+
+			if now.Sub(status.scraped) > trackerScrapeInterval {
+				stale[trackerURL] = status
+			}
+
+			statuses[trackerURL] = status
+		}
+		g.trackers[infoHash] = statuses
+		g.trackersLock.Unlock()
+
+		for trackerURL, status := range stale {
+			wg.Add(1)
+
+			go func(trackerURL string, status *trackerStatus) {
+				defer wg.Done()
+
+				result, err := scrapeTracker(ctx, g.trackerClientOpts, trackerURL, infoHash)
+				if err != nil {
+					g.log.Debug().
+						Err(err).
+						Str("infohash", infoHash.HexString()).
+						Str("tracker", trackerURL).
+						Msg("Could not scrape tracker")
+				}
+
+				g.trackersLock.Lock()
+				defer g.trackersLock.Unlock()
+
+				status.scrape = result
+				status.scrapeErr = err
+				status.scraped = time.Now()
+			}(trackerURL, status)
+		}
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) getTrackerMetrics(t *torrent.Torrent) []v1.TrackerMetrics {
+	g.trackersLock.Lock()
+	defer g.trackersLock.Unlock()
+
+	statuses := g.trackers[t.InfoHash()]
+
+	metrics := []v1.TrackerMetrics{}
+	for _, trackerURL := range getTrackers(t) {
+		status, ok := statuses[trackerURL]
+		if !ok {
+			continue
+		}
+
+		m := v1.TrackerMetrics{
+			URL:           trackerURL,
+			Peers:         status.announce.peers,
+			AnnounceError: status.announce.err,
+			Seeders:       int(status.scrape.Seeders),
+			Leechers:      int(status.scrape.Leechers),
+			Downloaded:    int(status.scrape.Completed),
+		}
+
+		if !status.announced.IsZero() {
+			m.Announced = status.announced.Unix()
+
+			if !status.announce.next.IsZero() {
+				m.Interval = int64(status.announce.next.Sub(status.announced).Round(time.Second).Seconds())
+			}
+		}
+
+		if !status.announce.next.IsZero() {
+			m.NextAnnounce = status.announce.next.Unix()
+		}
+
+		if !status.scraped.IsZero() {
+			m.Scraped = status.scraped.Unix()
+		}
+
+		if status.scrapeErr != nil {
+			m.ScrapeError = status.scrapeErr.Error()
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+func (g *Gateway) forgetTrackers(infoHash metainfo.Hash) {
+	g.trackersLock.Lock()
+	defer g.trackersLock.Unlock()
+
+	delete(g.trackers, infoHash)
+}
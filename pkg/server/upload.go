@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	uploadsDirectory = ".uploads"
+)
+
+var (
+	ErrInvalidUploadName = errors.New("invalid upload name, must be a file name without a directory")
+)
+
+func ParseUploadName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: %v", ErrInvalidUploadName, name)
+	}
+
+	return name, nil
+}
+
+func (g *Gateway) getUploadsDir() string {
+	return filepath.Join(g.storage, uploadsDirectory)
+}
+
+func (g *Gateway) uploadTorrent(name string, length int64, body io.Reader, opts CreateOptions) (*metainfo.MetaInfo, string, error) {
+	uploadsDir := g.getUploadsDir()
+	if err := os.MkdirAll(uploadsDir, os.ModePerm); err != nil {
+		return nil, "", err
+	}
+
+	b, err := newTorrentBuilder(name, max(length, 0), opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.CreateTemp(uploadsDir, "upload-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	if _, err := b.addFile(nil, io.TeeReader(body, f)); err != nil {
+		_ = os.Remove(f.Name())
+
+		return nil, "", err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+
+		return nil, "", err
+	}
+
+	mi, err := b.metainfo()
+	if err != nil {
+		_ = os.Remove(f.Name())
+
+		return nil, "", err
+	}
+
+	return mi, f.Name(), nil
+}
+
+func (g *Gateway) storeUpload(mi *metainfo.MetaInfo, name string, upload string) (string, error) {
+	infoHash, err := getShortInfoHash(mi)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(g.getUploadsDir(), infoHash.HexString())
+	root := filepath.Join(dir, name)
+
+	if _, err := os.Stat(root); err == nil {
+		return root, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(upload, root); err != nil {
+		return "", err
+	}
+
+	return root, nil
+}
+
+func (g *Gateway) discardUpload(upload string) error {
+	if err := os.Remove(upload); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (g *Gateway) removeUpload(infoHash metainfo.Hash) error {
+	return os.RemoveAll(filepath.Join(g.getUploadsDir(), infoHash.HexString()))
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pojntfx/go-auth-utils/pkg/authn"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	argon2Time     = 3
+	argon2Memory   = 64 * 1024
+	argon2Threads  = 4
+	argon2KeyLen   = 32
+	argon2SaltLen  = 16
+
+	argon2MaxTime    = 64
+	argon2MaxMemory  = 4 * 1024 * 1024
+	argon2MinSaltLen = 8
+	argon2MinKeyLen  = 16
+	argon2MaxKeyLen  = 1024
+)
+
+var (
+	ErrInvalidUsersLine     = errors.New("invalid line in users file")
+	ErrUnsupportedHash      = errors.New("unsupported password hash")
+	ErrInvalidArgon2Hash    = errors.New("invalid argon2id password hash")
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+)
+
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+type PasswordHash struct {
+	bcrypt []byte
+	argon2 *argon2Hash
+}
+
+func ParsePasswordHash(hash string) (PasswordHash, error) {
+	hash = strings.TrimSpace(hash)
+
+	if strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$") {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return PasswordHash{}, fmt.Errorf("%w: %v", ErrUnsupportedHash, err)
+		}
+
+		return PasswordHash{
+			bcrypt: []byte(hash),
+		}, nil
+	}
+
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return PasswordHash{}, ErrUnsupportedHash
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return PasswordHash{}, ErrInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return PasswordHash{}, ErrInvalidArgon2Hash
+	}
+
+	var (
+		memory  uint32
+		time    uint32
+		threads uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return PasswordHash{}, ErrInvalidArgon2Hash
+	}
+
+	if time < 1 || time > argon2MaxTime || threads < 1 || memory < 8*uint32(threads) || memory > argon2MaxMemory {
+		return PasswordHash{}, fmt.Errorf("%w: m=%v,t=%v,p=%v is out of range", ErrInvalidArgon2Hash, memory, time, threads)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < argon2MinSaltLen {
+		return PasswordHash{}, ErrInvalidArgon2Hash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < argon2MinKeyLen || len(key) > argon2MaxKeyLen {
+		return PasswordHash{}, ErrInvalidArgon2Hash
+	}
+
+	return PasswordHash{
+		argon2: &argon2Hash{
+			memory:  memory,
+			time:    time,
+			threads: threads,
+			salt:    salt,
+			key:     key,
+		},
+	}, nil
+}
+
+func LoadUsers(usersFile string) (map[string]PasswordHash, error) {
+	f, err := os.Open(usersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]PasswordHash{}
+
+	scanner := bufio.NewScanner(f)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(username) == "" || strings.TrimSpace(hash) == "" {
+			return nil, fmt.Errorf("%w: %v:%v", ErrInvalidUsersLine, usersFile, i)
+		}
+
+		h, err := ParsePasswordHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v:%v", err, usersFile, i)
+		}
+
+		users[strings.TrimSpace(username)] = h
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func HashPassword(password string, algorithm string) (string, error) {
+	switch algorithm {
+	case "bcrypt":
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(hash), nil
+	case "argon2id":
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+		return fmt.Sprintf(
+			"%vv=%v$m=%v,t=%v,p=%v$%v$%v",
+			argon2idPrefix,
+			argon2.Version,
+			argon2Memory,
+			argon2Time,
+			argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("%w: %v", ErrUnknownHashAlgorithm, algorithm)
+	}
+}
+
+func (h PasswordHash) verify(password string) error {
+	if h.argon2 == nil {
+		if err := bcrypt.CompareHashAndPassword(h.bcrypt, []byte(password)); err != nil {
+			return authn.ErrWrongPassword
+		}
+
+		return nil
+	}
+
+	a := h.argon2
+	if subtle.ConstantTimeCompare(argon2.IDKey([]byte(password), a.salt, a.time, a.memory, a.threads, uint32(len(a.key))), a.key) != 1 {
+		return authn.ErrWrongPassword
+	}
+
+	return nil
+}
+
+func newDummyPasswordHash(h PasswordHash) PasswordHash {
+	password := make([]byte, argon2SaltLen)
+	_, _ = rand.Read(password)
+
+	if h.argon2 == nil {
+		cost, err := bcrypt.Cost(h.bcrypt)
+		if err != nil {
+			cost = bcrypt.DefaultCost
+		}
+
+		hash, err := bcrypt.GenerateFromPassword(password, cost)
+		if err != nil {
+			return h
+		}
+
+		return PasswordHash{
+			bcrypt: hash,
+		}
+	}
+
+	a := *h.argon2
+	a.salt = make([]byte, len(h.argon2.salt))
+	_, _ = rand.Read(a.salt)
+	a.key = argon2.IDKey(password, a.salt, a.time, a.memory, a.threads, uint32(len(h.argon2.key)))
+
+	return PasswordHash{
+		argon2: &a,
+	}
+}
+
+type usersAuthn struct {
+	users map[string]PasswordHash
+	dummy PasswordHash
+}
+
+func NewUsersAuthn(users map[string]PasswordHash) authn.Authn {
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
+	}
+	slices.Sort(usernames)
+
+	var dummy PasswordHash
+	if len(usernames) > 0 {
+		dummy = newDummyPasswordHash(users[usernames[0]])
+	} else {
+		dummy = newDummyPasswordHash(PasswordHash{})
+	}
+
+	return &usersAuthn{
+		users: users,
+		dummy: dummy,
+	}
+}
+
+func (a *usersAuthn) Open(context.Context) error {
+	return nil
+}
+
+func (a *usersAuthn) Validate(username, token string) error {
+	hash, ok := a.users[username]
+	if !ok {
+		_ = a.dummy.verify(token)
+
+		return authn.ErrWrongUsername
+	}
+
+	return hash.verify(token)
+}
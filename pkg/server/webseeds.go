@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	v1 "github.com/pojntfx/htorrent/pkg/api/http/v1"
+)
+
+const (
+	webSeedNetwork = "http"
+)
+
+var (
+	ErrInvalidWebSeed = errors.New("invalid web seed, expected a http:// or https:// URL")
+)
+
+type sourceStats struct {
+	peers    int64
+	webSeeds map[string]int64
+}
+
+func ParseWebSeed(webSeed string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(webSeed))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidWebSeed, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: %v", ErrInvalidWebSeed, webSeed)
+	}
+
+	return u.String(), nil
+}
+
+func (g *Gateway) onReceivedUsefulData(e torrent.ReceivedUsefulDataEvent) {
+	infoHash := e.Peer.Torrent().InfoHash()
+	n := int64(len(e.Message.Piece))
+
+	g.sourcesLock.Lock()
+	defer g.sourcesLock.Unlock()
+
+	stats, ok := g.sources[infoHash]
+	if !ok {
+		stats = &sourceStats{
+			webSeeds: map[string]int64{},
+		}
+
+		g.sources[infoHash] = stats
+	}
+
+	if e.Peer.Network == webSeedNetwork {
+		stats.webSeeds[e.Peer.RemoteAddr.String()] += n
+	} else {
+		stats.peers += n
+	}
+}
+
+func (g *Gateway) getSourceMetrics(infoHash metainfo.Hash) (downloadedFromPeers int64, downloadedFromWebSeeds int64, webSeeds []v1.WebSeedMetrics) {
+	g.sourcesLock.Lock()
+	defer g.sourcesLock.Unlock()
+
+	webSeeds = []v1.WebSeedMetrics{}
+
+	stats, ok := g.sources[infoHash]
+	if !ok {
+		return 0, 0, webSeeds
+	}
+
+	for host, downloaded := range stats.webSeeds {
+		downloadedFromWebSeeds += downloaded
+
+		webSeeds = append(webSeeds, v1.WebSeedMetrics{
+			Host:       host,
+			Downloaded: downloaded,
+		})
+	}
+
+	sort.Slice(webSeeds, func(i, j int) bool {
+		return webSeeds[i].Host < webSeeds[j].Host
+	})
+
+	return stats.peers, downloadedFromWebSeeds, webSeeds
+}
+
+func (g *Gateway) forgetSources(infoHash metainfo.Hash) {
+	g.sourcesLock.Lock()
+	defer g.sourcesLock.Unlock()
+
+	delete(g.sources, infoHash)
+}
+
+func (g *Gateway) addWebSeeds(t *torrent.Torrent, webSeeds []string) error {
+	t.AddWebSeeds(webSeeds)
+
+	if g.session == nil {
+		return nil
+	}
+
+	return g.session.update(t.InfoHash(), func(st *sessionTorrent) {
+		for _, webSeed := range webSeeds {
+			found := false
+			for _, candidate := range st.WebSeeds {
+				if candidate == webSeed {
+					found = true
+
+					break
+				}
+			}
+
+			if !found {
+				st.WebSeeds = append(st.WebSeeds, webSeed)
+			}
+		}
+	})
+}
+
+func addMagnetSources(t *torrent.Torrent, magnetLink string) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetLink)
+	if err != nil {
+		return
+	}
+
+	for _, trackers := range spec.Trackers {
+		if len(trackers) > 0 {
+			t.AddTrackers([][]string{trackers})
+		}
+	}
+
+	t.AddWebSeeds(spec.Webseeds)
+}